@@ -9,7 +9,7 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
-	"time"
+	"syscall"
 )
 
 func main() {
@@ -35,7 +35,7 @@ func main() {
 	}()
 
 	stopSignal := make(chan os.Signal, 1)
-	signal.Notify(stopSignal, os.Interrupt)
+	signal.Notify(stopSignal, os.Interrupt, syscall.SIGTERM)
 
 	logger.Info("Application started")
 
@@ -45,7 +45,7 @@ func main() {
 		logger.Info("Application exited unexpectedly", slog.String("error", err.Error()))
 	case sig := <-stopSignal:
 		logger.Info("Stopping application", slog.String("signal", sig.String()))
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Shutdown.Timeout)
 		defer cancel()
 		if err := application.Stop(ctx); err != nil {
 			logger.Info("Application exited with error", slog.String("error", err.Error()))
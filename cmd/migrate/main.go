@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"io-load-api/internal/config"
 )
@@ -23,20 +24,31 @@ func main() {
 		panic("Must specify migrations path")
 	}
 
-	postgresURL := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s?sslmode=disable&x-migrations-table=%s",
-		cfg.PostgresDB.Username, cfg.PostgresDB.Password,
-		cfg.PostgresDB.Host, cfg.PostgresDB.Port,
-		cfg.PostgresDB.DBName, migrationsTable,
-	)
-	sourceURL := fmt.Sprintf(
-		"file://%s",
-		migrationsPath,
-	)
+	var databaseURL, sourceURL string
+	switch cfg.Storage {
+	case config.PostgresStorage:
+		databaseURL = fmt.Sprintf(
+			"postgres://%s:%s@%s:%s/%s?sslmode=disable&x-migrations-table=%s",
+			cfg.PostgresDB.Username, cfg.PostgresDB.Password,
+			cfg.PostgresDB.Host, cfg.PostgresDB.Port,
+			cfg.PostgresDB.DBName, migrationsTable,
+		)
+		sourceURL = fmt.Sprintf(
+			"file://%s",
+			migrationsPath,
+		)
+	case config.SQLiteStorage:
+		// SQLite migrations live in their own directory, which the Postgres source skips
+		databaseURL = fmt.Sprintf("sqlite://%s?x-migrations-table=%s", cfg.SQLite.Path, migrationsTable)
+		sourceURL = fmt.Sprintf("file://%s/sqlite", migrationsPath)
+	default:
+		fmt.Printf("Storage %q has nothing to migrate\n", cfg.Storage)
+		return
+	}
 
 	m, err := migrate.New(
 		sourceURL,
-		postgresURL,
+		databaseURL,
 	)
 	if err != nil {
 		panic(err)
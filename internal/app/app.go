@@ -2,10 +2,16 @@ package app
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"io-load-api/internal/broker"
 	"io-load-api/internal/config"
+	"io-load-api/internal/model"
 	"io-load-api/internal/service"
-	"io-load-api/internal/store/postgres"
 	"io-load-api/internal/transport/http/handler"
+	"io-load-api/internal/utils/io"
+	"io-load-api/internal/webhook"
+	"io-load-api/internal/worker"
 	"log/slog"
 	"net/http"
 )
@@ -14,30 +20,76 @@ import (
 type App struct {
 	HTTPServer *http.Server
 	log        *slog.Logger
+	services   *service.TaskService
+	schedules  *service.ScheduleService
+	listener   background
+	elector    elector
+	webhooks   *webhook.Notifier
 }
 
+// New builds the application on the storage selected in cfg
 func New(log *slog.Logger, cfg *config.Config) (*App, error) {
-	store, err := postgres.New(log, cfg)
+	events := broker.New(log)
+	backend, err := newBackend(log, cfg, events)
 	if err != nil {
 		return nil, err
 	}
-	taskStore := postgres.NewTaskStore(store)
-	services := service.NewTaskService(log, taskStore)
-	handlers := handler.New(log, services)
-	return &App{
-		HTTPServer: &http.Server{
-			Addr:    cfg.HTTPServer.Addr,
-			Handler: handlers.InitRoutes(),
+	pool := worker.NewPool(log, cfg)
+	registry := service.NewRegistry()
+	err = registry.Register(service.SimulateIOTaskType, service.TaskHandlerFunc(
+		func(ctx context.Context, _ model.Task) (json.RawMessage, error) {
+			return nil, io.SimulateIOProcessing(ctx)
 		},
-		log: log,
+	))
+	if err != nil {
+		return nil, err
+	}
+	webhooks := webhook.NewNotifier(log, backend.deliveries, cfg)
+	services := service.NewTaskService(log, backend.tasks, pool, registry, events, webhooks, cfg)
+	schedules := service.NewScheduleService(log, backend.schedules, services, backend.elector, cfg)
+	handlers := handler.New(log, services, schedules, events)
+	httpServer := &http.Server{
+		Addr:    cfg.HTTPServer.Addr,
+		Handler: handlers.InitRoutes(),
+	}
+	// Event streams never end by themselves, so they are closed for Shutdown to complete
+	httpServer.RegisterOnShutdown(events.Close)
+	return &App{
+		HTTPServer: httpServer,
+		log:        log,
+		services:   services,
+		schedules:  schedules,
+		listener:   backend.listener,
+		elector:    backend.elector,
+		webhooks:   webhooks,
 	}, nil
 }
 func (app *App) MustRun() error {
+	if app.listener != nil {
+		app.log.Info("Listening for task changes of other instances")
+		app.listener.Start()
+	}
+	app.log.Info("Running task workers")
+	app.services.Start()
+	app.log.Info("Running recurring schedules")
+	app.elector.Start()
+	app.schedules.Start()
 	app.log.Info("Running HTTP server")
 	return app.HTTPServer.ListenAndServe()
 }
 
+// Stop stops accepting new tasks and HTTP requests, then waits for running tasks until ctx expires.
+// Tasks interrupted by ctx expiration are requeued to be picked up by another instance or after restart
 func (app *App) Stop(ctx context.Context) error {
 	app.log.Info("Stopping HTTP server")
-	return app.HTTPServer.Shutdown(ctx)
+	httpErr := app.HTTPServer.Shutdown(ctx)
+	if app.listener != nil {
+		app.listener.Stop()
+	}
+	app.schedules.Stop()
+	app.elector.Stop()
+	app.log.Info("Draining task workers")
+	servicesErr := app.services.Stop(ctx)
+	app.log.Info("Finishing webhook deliveries")
+	return errors.Join(httpErr, servicesErr, app.webhooks.Stop(ctx))
 }
@@ -0,0 +1,46 @@
+package app_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io-load-api/internal/app"
+	"io-load-api/internal/config"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew_MemoryStorage(t *testing.T) {
+	cfg := &config.Config{
+		Storage:    config.MemoryStorage,
+		WorkerPool: config.WorkerPool{Size: 1, QueueCapacity: 10, PollInterval: time.Second},
+		Scheduler:  config.Scheduler{PromoteInterval: time.Second, CronInterval: time.Second},
+		Recovery:   config.Recovery{LeaseDuration: time.Minute, HeartbeatInterval: time.Second, ReapInterval: time.Minute},
+		Retry:      config.Retry{MaxAttempts: 3, BaseDelay: time.Second, Multiplier: 2},
+	}
+	application, err := app.New(slog.Default(), cfg)
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest("POST", "/api/tasks", strings.NewReader(`{"run_at": "2100-01-01T00:00:00Z"}`))
+	rec := httptest.NewRecorder()
+	application.HTTPServer.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req, _ = http.NewRequest("GET", "/api/tasks/1", nil)
+	rec = httptest.NewRecorder()
+	application.HTTPServer.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"state":"SCHEDULED"`)
+
+	assert.NoError(t, application.Stop(context.Background()))
+}
+
+func TestNew_UnknownStorage(t *testing.T) {
+	_, err := app.New(slog.Default(), &config.Config{Storage: "cassandra"})
+
+	assert.ErrorContains(t, err, "unknown storage")
+}
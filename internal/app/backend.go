@@ -0,0 +1,89 @@
+package app
+
+import (
+	"fmt"
+	"io-load-api/internal/broker"
+	"io-load-api/internal/config"
+	"io-load-api/internal/service"
+	"io-load-api/internal/store"
+	"io-load-api/internal/store/postgres"
+	"io-load-api/internal/store/sqlite"
+	"io-load-api/internal/webhook"
+	"log/slog"
+)
+
+// background is a component running in background between Start and Stop
+type background interface {
+	Start()
+	Stop()
+}
+
+// elector campaigns for the leadership which lets the instance fire recurring schedules
+type elector interface {
+	background
+	service.Leader
+}
+
+// backend holds stores of the configured storage and the components which coordinate instances through it
+type backend struct {
+	tasks      service.Store
+	schedules  service.ScheduleStore
+	deliveries webhook.DeliveryLog
+	// listener publishes changes made by other instances. It is nil if the storage is not shared
+	listener background
+	elector  elector
+}
+
+func newBackend(log *slog.Logger, cfg *config.Config, events *broker.Broker) (backend, error) {
+	switch cfg.Storage {
+	case config.MemoryStorage:
+		tasks := store.NewTaskStore(log)
+		return backend{
+			tasks:      tasks,
+			schedules:  store.NewScheduleStore(tasks),
+			deliveries: store.NewDeliveryStore(),
+			elector:    soleLeader{},
+		}, nil
+	case config.PostgresStorage:
+		db, err := postgres.New(log, cfg)
+		if err != nil {
+			return backend{}, err
+		}
+		tasks := postgres.NewTaskStore(db)
+		return backend{
+			tasks:      tasks,
+			schedules:  postgres.NewScheduleStore(db),
+			deliveries: postgres.NewDeliveryStore(db),
+			listener:   postgres.NewListener(log, tasks, events),
+			elector:    postgres.NewElector(log, db, cfg.Scheduler.ElectionInterval),
+		}, nil
+	case config.SQLiteStorage:
+		db, err := sqlite.New(log, cfg)
+		if err != nil {
+			return backend{}, err
+		}
+		// Processes sharing the file are not notified about changes made by each other, and every one of them
+		// fires schedules, which is safe as an activation is fired once
+		return backend{
+			tasks:      sqlite.NewTaskStore(db),
+			schedules:  sqlite.NewScheduleStore(db),
+			deliveries: sqlite.NewDeliveryStore(db),
+			elector:    soleLeader{},
+		}, nil
+	}
+	return backend{}, fmt.Errorf(
+		"unknown storage %q, expected %q, %q or %q",
+		cfg.Storage, config.MemoryStorage, config.PostgresStorage, config.SQLiteStorage,
+	)
+}
+
+// soleLeader leads an instance whose storage is not shared with other instances
+type soleLeader struct{}
+
+func (soleLeader) IsLeader() bool {
+	return true
+}
+
+func (soleLeader) Start() {}
+
+func (soleLeader) Stop() {}
@@ -0,0 +1,104 @@
+package broker
+
+import (
+	"io-load-api/internal/model"
+	"log/slog"
+	"sync"
+)
+
+// subscriberBuffer is how many task changes may wait for a slow subscriber before new ones are dropped
+const subscriberBuffer = 64
+
+// AllTasks subscribes to changes of every task
+const AllTasks int64 = 0
+
+type subscription struct {
+	taskID int64
+	events chan model.Task
+}
+
+// Broker delivers task state changes published by the service to subscribers within this process
+type Broker struct {
+	log *slog.Logger
+
+	mu            sync.Mutex
+	subscriptions map[*subscription]struct{}
+	closed        bool
+}
+
+func New(log *slog.Logger) *Broker {
+	return &Broker{
+		log:           log,
+		subscriptions: make(map[*subscription]struct{}),
+	}
+}
+
+// Publish sends a snapshot of task to subscribers of the task and of all tasks.
+// It never blocks: a subscriber which does not keep up misses the change
+func (b *Broker) Publish(task model.Task) {
+	const op = "broker.Publish"
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscriptions {
+		if sub.taskID != AllTasks && sub.taskID != task.ID {
+			continue
+		}
+		select {
+		case sub.events <- task:
+		default:
+			b.log.Warn(
+				"Dropped task change for slow subscriber",
+				slog.String("op", op),
+				slog.Int64("task_id", task.ID),
+				slog.String("state", string(task.State)),
+			)
+		}
+	}
+}
+
+// Subscribed reports whether anyone subscribes to changes of the task with taskID
+func (b *Broker) Subscribed(taskID int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscriptions {
+		if sub.taskID == AllTasks || sub.taskID == taskID {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribe returns a channel of changes of the task with taskID, or of all tasks if taskID is AllTasks,
+// and a function which cancels the subscription. The channel is closed on cancel or when the broker is closed
+func (b *Broker) Subscribe(taskID int64) (<-chan model.Task, func()) {
+	sub := &subscription{taskID: taskID, events: make(chan model.Task, subscriberBuffer)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(sub.events)
+		return sub.events, func() {}
+	}
+	b.subscriptions[sub] = struct{}{}
+
+	return sub.events, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscriptions[sub]; ok {
+			delete(b.subscriptions, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Close ends all subscriptions, so streaming clients are disconnected and the HTTP server can shut down
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscriptions {
+		delete(b.subscriptions, sub)
+		close(sub.events)
+	}
+}
@@ -0,0 +1,76 @@
+package broker_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io-load-api/internal/broker"
+	"io-load-api/internal/model"
+	"log/slog"
+	"testing"
+)
+
+func TestBroker_DeliversToMatchingSubscribers(t *testing.T) {
+	b := broker.New(slog.Default())
+
+	one, unsubscribeOne := b.Subscribe(1)
+	defer unsubscribeOne()
+	all, unsubscribeAll := b.Subscribe(broker.AllTasks)
+	defer unsubscribeAll()
+
+	b.Publish(model.Task{ID: 2, State: model.ProcessingState})
+	b.Publish(model.Task{ID: 1, State: model.CompletedState})
+
+	assert.Equal(t, model.Task{ID: 1, State: model.CompletedState}, <-one)
+	assert.Empty(t, one)
+	assert.Equal(t, model.Task{ID: 2, State: model.ProcessingState}, <-all)
+	assert.Equal(t, model.Task{ID: 1, State: model.CompletedState}, <-all)
+}
+
+func TestBroker_DropsChangesForSlowSubscriber(t *testing.T) {
+	b := broker.New(slog.Default())
+
+	events, unsubscribe := b.Subscribe(1)
+	defer unsubscribe()
+
+	for i := 0; i < 100; i++ {
+		b.Publish(model.Task{ID: 1, Attempts: i})
+	}
+
+	assert.Equal(t, 0, (<-events).Attempts)
+	assert.Less(t, len(events), 100)
+}
+
+func TestBroker_UnsubscribeAndClose(t *testing.T) {
+	b := broker.New(slog.Default())
+
+	events, unsubscribe := b.Subscribe(1)
+	unsubscribe()
+	unsubscribe()
+	_, ok := <-events
+	assert.False(t, ok)
+
+	events, _ = b.Subscribe(broker.AllTasks)
+	b.Close()
+	_, ok = <-events
+	assert.False(t, ok)
+
+	events, _ = b.Subscribe(1)
+	b.Publish(model.Task{ID: 1})
+	_, ok = <-events
+	assert.False(t, ok)
+}
+
+func TestBroker_Subscribed(t *testing.T) {
+	b := broker.New(slog.Default())
+	assert.False(t, b.Subscribed(1))
+
+	_, unsubscribeOne := b.Subscribe(1)
+	assert.True(t, b.Subscribed(1))
+	assert.False(t, b.Subscribed(2))
+
+	_, unsubscribeAll := b.Subscribe(broker.AllTasks)
+	assert.True(t, b.Subscribed(2))
+
+	unsubscribeOne()
+	unsubscribeAll()
+	assert.False(t, b.Subscribed(1))
+}
@@ -1,17 +1,43 @@
 package config
 
 import (
+	"fmt"
 	"github.com/ilyakaznacheev/cleanenv"
 	"log"
 	"os"
 	"time"
 )
 
+// Storage backends selected by Config.Storage
+const (
+	// MemoryStorage keeps everything in process memory. It is lost on exit and cannot be shared by instances
+	MemoryStorage   = "memory"
+	PostgresStorage = "postgres"
+	// SQLiteStorage keeps tasks in a local database file, for single host deployments
+	SQLiteStorage = "sqlite"
+)
+
+// Recovery policies selected by Recovery.Policy
+const (
+	// RequeuePolicy moves tasks whose lease has expired back to the queue
+	RequeuePolicy = "requeue"
+	// FailPolicy fails tasks whose lease has expired
+	FailPolicy = "fail"
+)
+
 // Config includes all params of application
 type Config struct {
 	PrometheusPort string     `yaml:"prometheus_port"`
+	Storage        string     `yaml:"storage" env:"STORAGE" env-default:"postgres"`
 	HTTPServer     HTTPServer `yaml:"http_server"`
 	PostgresDB     PostgresDB `yaml:"postgres_db"`
+	SQLite         SQLite     `yaml:"sqlite"`
+	WorkerPool     WorkerPool `yaml:"worker_pool"`
+	Scheduler      Scheduler  `yaml:"scheduler"`
+	Recovery       Recovery   `yaml:"recovery"`
+	Retry          Retry      `yaml:"retry"`
+	Shutdown       Shutdown   `yaml:"shutdown"`
+	Webhook        Webhook    `yaml:"webhook"`
 }
 
 type HTTPServer struct {
@@ -32,6 +58,70 @@ type PostgresDB struct {
 	HealthCheckPeriod time.Duration `yaml:"health_check_period" env-default:"10s"`
 }
 
+// SQLite is the database file of the sqlite storage. Writers wait up to BusyTimeout for other writers to finish
+type SQLite struct {
+	Path        string        `yaml:"path" env:"SQLITE_PATH" env-default:"io-load-api.db"`
+	BusyTimeout time.Duration `yaml:"busy_timeout" env-default:"5s"`
+}
+
+// WorkerPool limits how many tasks are processed at the same time and how many pending tasks may wait in the queue.
+// Idle workers poll the store for pending tasks every PollInterval
+type WorkerPool struct {
+	Size          int           `yaml:"size" env-default:"10"`
+	QueueCapacity int           `yaml:"queue_capacity" env-default:"100"`
+	PollInterval  time.Duration `yaml:"poll_interval" env-default:"1s"`
+}
+
+// Scheduler controls the order tasks are claimed in. Higher priority tasks go first, and a waiting task gains
+// one priority level every AgingInterval so low priority tasks are not starved. Zero AgingInterval disables aging.
+// Scheduled tasks whose run time has come are made pending every PromoteInterval.
+// The elected leader checks recurring schedules every CronInterval, instances campaign for leadership
+// every ElectionInterval
+type Scheduler struct {
+	AgingInterval    time.Duration `yaml:"aging_interval" env-default:"1m"`
+	PromoteInterval  time.Duration `yaml:"promote_interval" env-default:"1s"`
+	CronInterval     time.Duration `yaml:"cron_interval" env-default:"1s"`
+	ElectionInterval time.Duration `yaml:"election_interval" env-default:"5s"`
+}
+
+// Recovery controls task leases. Workers extend the lease of a running task every HeartbeatInterval.
+// Tasks whose lease has expired are requeued or failed according to Policy on startup and every ReapInterval
+type Recovery struct {
+	LeaseDuration     time.Duration `yaml:"lease_duration" env-default:"30s"`
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval" env-default:"10s"`
+	ReapInterval      time.Duration `yaml:"reap_interval" env-default:"15s"`
+	Policy            string        `yaml:"policy" env-default:"requeue"`
+}
+
+// Retry is the retry policy of tasks created without their own one
+type Retry struct {
+	MaxAttempts int           `yaml:"max_attempts" env-default:"3"`
+	BaseDelay   time.Duration `yaml:"base_delay" env-default:"1s"`
+	Multiplier  float64       `yaml:"multiplier" env-default:"2"`
+	Jitter      float64       `yaml:"jitter" env-default:"0.2"`
+}
+
+// Shutdown bounds how long the application waits for HTTP requests and running tasks on stop.
+// Tasks still running after Timeout are interrupted and requeued
+type Shutdown struct {
+	Timeout time.Duration `yaml:"timeout" env-default:"30s"`
+}
+
+// Webhook configures callbacks sent when tasks complete or fail. URL receives webhooks of tasks created without
+// their own callback URL, empty URL disables them. Callback URLs of tasks may point to internal addresses only
+// if their host is one of AllowedHosts. Payloads are signed with Secret if it is set.
+// Failed deliveries are retried up to MaxAttempts times with exponential backoff
+type Webhook struct {
+	URL          string        `yaml:"url"`
+	AllowedHosts []string      `yaml:"allowed_hosts"`
+	Secret       string        `env:"WEBHOOK_SECRET"`
+	Timeout      time.Duration `yaml:"timeout" env-default:"5s"`
+	MaxAttempts  int           `yaml:"max_attempts" env-default:"5"`
+	BaseDelay    time.Duration `yaml:"base_delay" env-default:"1s"`
+	Multiplier   float64       `yaml:"multiplier" env-default:"2"`
+	Jitter       float64       `yaml:"jitter" env-default:"0.2"`
+}
+
 // MustLoad loads configuration or stopping application
 func MustLoad() *Config {
 	configPath, exists := os.LookupEnv("CONFIG_PATH")
@@ -48,5 +138,49 @@ func MustLoad() *Config {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
 	return &cfg
 }
+
+// Validate rejects settings which select an unknown option, intervals which are not positive and leases
+// which would expire between heartbeats
+func (c *Config) Validate() error {
+	switch c.Storage {
+	case MemoryStorage, PostgresStorage, SQLiteStorage:
+	default:
+		return fmt.Errorf(
+			"unknown storage %q, expected %q, %q or %q", c.Storage, MemoryStorage, PostgresStorage, SQLiteStorage,
+		)
+	}
+	switch c.Recovery.Policy {
+	case RequeuePolicy, FailPolicy:
+	default:
+		return fmt.Errorf("unknown recovery policy %q, expected %q or %q", c.Recovery.Policy, RequeuePolicy, FailPolicy)
+	}
+	intervals := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"worker_pool.poll_interval", c.WorkerPool.PollInterval},
+		{"scheduler.promote_interval", c.Scheduler.PromoteInterval},
+		{"scheduler.cron_interval", c.Scheduler.CronInterval},
+		{"scheduler.election_interval", c.Scheduler.ElectionInterval},
+		{"recovery.lease_duration", c.Recovery.LeaseDuration},
+		{"recovery.heartbeat_interval", c.Recovery.HeartbeatInterval},
+		{"recovery.reap_interval", c.Recovery.ReapInterval},
+	}
+	for _, interval := range intervals {
+		if interval.value <= 0 {
+			return fmt.Errorf("%s must be positive, got %s", interval.name, interval.value)
+		}
+	}
+	if c.Recovery.HeartbeatInterval >= c.Recovery.LeaseDuration {
+		return fmt.Errorf(
+			"recovery.heartbeat_interval %s must be shorter than recovery.lease_duration %s",
+			c.Recovery.HeartbeatInterval, c.Recovery.LeaseDuration,
+		)
+	}
+	return nil
+}
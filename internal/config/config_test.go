@@ -0,0 +1,64 @@
+package config_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io-load-api/internal/config"
+	"testing"
+	"time"
+)
+
+// validConfig returns a config with the default intervals
+func validConfig() config.Config {
+	return config.Config{
+		Storage:    config.PostgresStorage,
+		WorkerPool: config.WorkerPool{PollInterval: time.Second},
+		Scheduler: config.Scheduler{
+			PromoteInterval:  time.Second,
+			CronInterval:     time.Second,
+			ElectionInterval: 5 * time.Second,
+		},
+		Recovery: config.Recovery{
+			LeaseDuration:     30 * time.Second,
+			HeartbeatInterval: 10 * time.Second,
+			ReapInterval:      15 * time.Second,
+			Policy:            config.RequeuePolicy,
+		},
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *config.Config)
+		valid  bool
+	}{
+		{"requeue", func(cfg *config.Config) {}, true},
+		{"fail", func(cfg *config.Config) {
+			cfg.Storage, cfg.Recovery.Policy = config.SQLiteStorage, config.FailPolicy
+		}, true},
+		{"unknown policy", func(cfg *config.Config) { cfg.Recovery.Policy = "failed" }, false},
+		{"policy is case sensitive", func(cfg *config.Config) { cfg.Recovery.Policy = "FAIL" }, false},
+		{"unknown storage", func(cfg *config.Config) { cfg.Storage = "mysql" }, false},
+		{"zero poll interval", func(cfg *config.Config) { cfg.WorkerPool.PollInterval = 0 }, false},
+		{"negative reap interval", func(cfg *config.Config) { cfg.Recovery.ReapInterval = -time.Second }, false},
+		{"zero heartbeat interval", func(cfg *config.Config) { cfg.Recovery.HeartbeatInterval = 0 }, false},
+		{"zero promote interval", func(cfg *config.Config) { cfg.Scheduler.PromoteInterval = 0 }, false},
+		{"heartbeat as long as lease", func(cfg *config.Config) {
+			cfg.Recovery.HeartbeatInterval = cfg.Recovery.LeaseDuration
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(&cfg)
+
+			err := cfg.Validate()
+
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -23,7 +23,7 @@ var (
 	TaskProcessed = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "tasks_processed_total",
-			Help: "Total number of tasks processed",
+			Help: "Total number of tasks which finished processing",
 		},
 		[]string{"status"},
 	)
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// Schedule creates a task from Template at every activation of the cron expression Cron
+type Schedule struct {
+	ID       int64
+	Cron     string
+	Template TaskSpec
+	// NextRunAt is the next activation, LastRunAt is the last one a task was created at
+	NextRunAt time.Time
+	LastRunAt *time.Time
+	CreatedAt time.Time
+}
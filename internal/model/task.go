@@ -1,20 +1,152 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type TaskState string
 
 const (
+	// ScheduledState tasks wait for their run time before becoming pending
+	ScheduledState TaskState = "SCHEDULED"
+	// WaitingState tasks wait for the tasks they depend on to complete
+	WaitingState    TaskState = "WAITING"
 	PendingState    TaskState = "PENDING"
 	ProcessingState TaskState = "PROCESSING"
-	CompletedState  TaskState = "DONE"
-	FailedState     TaskState = "FAILED"
+	RetryingState   TaskState = "RETRYING"
+	// AwaitingChildrenState tasks have been handled and complete once all children they spawned have finished
+	AwaitingChildrenState TaskState = "AWAITING_CHILDREN"
+	CompletedState        TaskState = "DONE"
+	FailedState           TaskState = "FAILED"
+	CancelledState        TaskState = "CANCELLED"
+	TimedOutState         TaskState = "TIMED_OUT"
+)
+
+// Valid reports whether s is one of known task states
+func (s TaskState) Valid() bool {
+	switch s {
+	case ScheduledState, WaitingState, PendingState, ProcessingState, RetryingState, AwaitingChildrenState,
+		CompletedState, FailedState, CancelledState, TimedOutState:
+		return true
+	}
+	return false
+}
+
+// Finished reports whether s is a final state which a task never leaves
+func (s TaskState) Finished() bool {
+	switch s {
+	case CompletedState, FailedState, CancelledState, TimedOutState:
+		return true
+	}
+	return false
+}
+
+// Error codes describing why the last attempt of a task failed
+const (
+	HandlerErrorCode      = "HANDLER_ERROR"
+	TimeoutErrorCode      = "TIMEOUT"
+	LeaseExpiredErrorCode = "LEASE_EXPIRED"
+	UnknownTypeErrorCode  = "UNKNOWN_TYPE"
+	// DependencyFailedErrorCode fails a task which depends on a task which did not complete
+	DependencyFailedErrorCode = "DEPENDENCY_FAILED"
+)
+
+// Task priorities accepted from clients. Tasks are created with DefaultPriority unless another one is given
+const (
+	MinPriority     = -100
+	MaxPriority     = 100
+	DefaultPriority = 0
 )
 
+// RetryPolicy describes how many times a failed task is run and how long to wait between attempts.
+// The delay before attempt n+1 is BaseDelay * Multiplier^(n-1), randomized by up to Jitter fraction of it
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	Multiplier  float64
+	Jitter      float64
+}
+
 type Task struct {
 	ID               int64
+	Type             string
 	State            TaskState
 	CreatedAt        time.Time
 	ProcessStartedAt *time.Time
 	ProcessEndedAt   *time.Time
+	LeaseExpiresAt   *time.Time
+	Attempts         int
+	// Priority orders pending tasks, higher ones are claimed first
+	Priority    int
+	RetryPolicy RetryPolicy
+	NextRunAt   *time.Time
+	// RunAt is the time a scheduled task becomes pending. It is nil for tasks which may start right away
+	RunAt *time.Time
+	// DependsOn lists tasks which must complete before the task may start
+	DependsOn []int64
+	// ParentID is the task which spawned this one from its handler. It is nil for tasks created by clients
+	ParentID *int64
+	// Timeout bounds a single attempt, Deadline bounds the whole task. Zero values mean no limit
+	Timeout  time.Duration
+	Deadline *time.Time
+	// Payload is an arbitrary JSON input of the task, Result is a JSON output written by its handler on success.
+	// The result of a parent is {"result": <own result>, "children": [...]} with the outcome of every child
+	Payload json.RawMessage
+	Result  json.RawMessage
+	// Error and ErrorCode describe the failure of the last attempt. They are empty if it succeeded
+	Error     string
+	ErrorCode string
+	// CallbackURL receives a webhook when the task completes or fails. Empty means the global webhook URL from config
+	CallbackURL string
+	// IdempotencyKey identifies the client request which created the task, RequestHash is a fingerprint
+	// of its spec used to detect the key reused for a different request
+	IdempotencyKey string
+	RequestHash    string
+}
+
+// TaskSpec contains options supplied by client when creating a task
+type TaskSpec struct {
+	Type        string
+	Priority    int
+	RetryPolicy *RetryPolicy
+	Timeout     time.Duration
+	Deadline    *time.Time
+	// RunAt or Delay postpone the start of the task. At most one of them may be set
+	RunAt       *time.Time
+	Delay       time.Duration
+	DependsOn   []int64
+	Payload     json.RawMessage
+	CallbackURL string
+	// IdempotencyKey makes repeated requests with the same key return the task created by the first one
+	IdempotencyKey string
+}
+
+// TaskQuery is a client request for a page of tasks. Cursor is taken from the previous page, empty for the first one
+type TaskQuery struct {
+	States        []TaskState
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Descending    bool
+	Limit         int
+	Cursor        string
+}
+
+// TaskPage holds tasks of one page and the cursor of the next page. NextCursor is empty on the last page
+type TaskPage struct {
+	Tasks      []Task
+	NextCursor string
+}
+
+// TaskFilter selects tasks from store ordered by ID, which follows creation order.
+// CreatedAfter is inclusive, CreatedBefore is exclusive. Only tasks following AfterID in the chosen order
+// are selected if it is set, only children of ParentID if it is set. Zero Limit means no limit
+type TaskFilter struct {
+	States        []TaskState
+	ParentID      *int64
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	AfterID       int64
+	Descending    bool
+	Limit         int
 }
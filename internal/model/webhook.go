@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// WebhookDelivery is a record of a single attempt to deliver a task webhook.
+// StatusCode is zero and Error is set if no response was received
+type WebhookDelivery struct {
+	ID         int64
+	TaskID     int64
+	URL        string
+	Attempt    int
+	StatusCode int
+	Error      string
+	Delivered  bool
+	CreatedAt  time.Time
+}
@@ -0,0 +1,9 @@
+package model
+
+// WorkflowNode is a task of a workflow. DependsOn lists keys of other nodes of the same workflow
+// which must complete before the task may start
+type WorkflowNode struct {
+	Key       string
+	DependsOn []string
+	Spec      TaskSpec
+}
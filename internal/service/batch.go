@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io-load-api/internal/model"
+	"log/slog"
+)
+
+// MaxBatchSize is the largest number of tasks created by one CreateTasks call
+const MaxBatchSize = 10000
+
+// CreateTasks creates pending tasks from specs at once and returns their IDs in the order of specs.
+// Either all tasks are created or none. It returns ErrInvalidTaskSpec if any spec is invalid and ErrQueueFull
+// if the queue is already full, a batch accepted into a queue with free space may exceed its capacity
+func (s *TaskService) CreateTasks(ctx context.Context, specs []model.TaskSpec) ([]int64, error) {
+	const op = "service.CreateTasks"
+	log := s.log.With(slog.String("op", op))
+
+	if s.draining.Load() {
+		return nil, fmt.Errorf("%s: %w", op, ErrShuttingDown)
+	}
+
+	tasks, parentIDs, err := s.newBatch(specs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := s.checkDependencies(ctx, parentIDs); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pending, err := s.store.CountByState(ctx, model.PendingState)
+	if err != nil {
+		return nil, err
+	}
+	if pending >= s.queueCapacity {
+		log.Warn("Task queue is full", slog.Int("pending_tasks", pending))
+		return nil, fmt.Errorf("%s: %w", op, ErrQueueFull)
+	}
+
+	ids, err := s.createBatch(ctx, tasks, len(parentIDs) > 0)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+	log.Info("Created tasks", slog.Int("tasks_count", len(ids)))
+	return ids, nil
+}
+
+// newBatch builds tasks from specs of a batch. It also returns IDs of tasks they depend on
+func (s *TaskService) newBatch(specs []model.TaskSpec) ([]model.Task, []int64, error) {
+	if len(specs) == 0 || len(specs) > MaxBatchSize {
+		return nil, nil, fmt.Errorf("%w: batch must contain from 1 to %d tasks", ErrInvalidTaskSpec, MaxBatchSize)
+	}
+
+	tasks := make([]model.Task, len(specs))
+	var parentIDs []int64
+	for i, spec := range specs {
+		if spec.IdempotencyKey != "" {
+			return nil, nil, fmt.Errorf("%w: task %d: idempotency keys are not supported in batches", ErrInvalidTaskSpec, i)
+		}
+		task, err := s.newTask(spec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("task %d: %w", i, err)
+		}
+		tasks[i] = task
+		parentIDs = append(parentIDs, task.DependsOn...)
+	}
+	return tasks, parentIDs, nil
+}
+
+// createBatch stores tasks at once, publishes the stored tasks and wakes up workers to claim the pending ones.
+// Tasks with dependencies which have already finished are resolved right away
+func (s *TaskService) createBatch(ctx context.Context, tasks []model.Task, hasDependencies bool) ([]int64, error) {
+	created, err := s.store.CreateBatch(ctx, tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(created))
+	for i, task := range created {
+		ids[i] = task.ID
+		s.events.Publish(task)
+		if startsRightAway(task) {
+			s.pool.Notify()
+		}
+	}
+	if hasDependencies {
+		s.resolveDependencies(ctx)
+	}
+	return ids, nil
+}
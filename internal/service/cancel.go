@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io-load-api/internal/metrics"
+	"io-load-api/internal/model"
+	"io-load-api/internal/store"
+	"log/slog"
+	"time"
+)
+
+var (
+	errTaskCancelled = errors.New("task cancelled")
+	errLeaseLost     = errors.New("task lease lost")
+)
+
+// CancelTask cancels a task which has not finished yet together with its unfinished children.
+// Pending tasks are cancelled right away, running ones are signalled through their context. It returns ErrTaskNotFound or ErrTaskFinished
+// if there is nothing to cancel
+func (s *TaskService) CancelTask(ctx context.Context, taskID int64) (model.Task, error) {
+	const op = "service.CancelTask"
+	log := s.log.With(slog.String("op", op))
+
+	task, err := s.store.Cancel(ctx, taskID, time.Now())
+	switch {
+	case errors.Is(err, store.ErrTaskNotFound):
+		return model.Task{}, fmt.Errorf("%s: %w", op, ErrTaskNotFound)
+	case errors.Is(err, store.ErrTaskFinished):
+		return model.Task{}, fmt.Errorf("%s: %w", op, ErrTaskFinished)
+	case err != nil:
+		log.Error(err.Error())
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+
+	// Tasks running on other instances stop when their heartbeat fails to extend the lease
+	s.mu.Lock()
+	cancel, running := s.running[taskID]
+	s.mu.Unlock()
+	if running {
+		cancel(errTaskCancelled)
+	}
+
+	s.events.Publish(task)
+	s.cancelChildren(ctx, taskID)
+	s.resolveDependencies(ctx)
+	log.Info("Cancelled task", slog.Int64("task_id", taskID), slog.Bool("was_running_here", running))
+	metrics.TaskProcessed.WithLabelValues(string(model.CancelledState)).Inc()
+	return task, nil
+}
+
+func (s *TaskService) track(taskID int64, cancel context.CancelCauseFunc) {
+	s.mu.Lock()
+	s.running[taskID] = cancel
+	s.mu.Unlock()
+}
+
+func (s *TaskService) untrack(taskID int64) {
+	s.mu.Lock()
+	delete(s.running, taskID)
+	s.mu.Unlock()
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io-load-api/internal/model"
+	"io-load-api/internal/store"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// ErrNotInHandler means children were spawned with a context which does not belong to a running task handler
+var ErrNotInHandler = errors.New("not called from a task handler")
+
+// spawnerKey is the context key of the spawner of the task being handled
+type spawnerKey struct{}
+
+// spawner creates children of the task being handled and remembers them, so that children of an attempt
+// which does not succeed can be cancelled
+type spawner struct {
+	service  *TaskService
+	parentID int64
+
+	mu  sync.Mutex
+	ids []int64
+}
+
+// withSpawner returns ctx which lets the handler of task spawn its children
+func (s *TaskService) withSpawner(ctx context.Context, task model.Task) (context.Context, *spawner) {
+	sp := &spawner{service: s, parentID: task.ID}
+	return context.WithValue(ctx, spawnerKey{}, sp), sp
+}
+
+// SpawnChildren creates child tasks of the task whose handler received ctx and returns their IDs in the order
+// of specs. Once the handler succeeds, the parent waits in awaiting children state until all its children
+// have finished and then completes with their results aggregated into its own. If the handler fails, times out
+// or is interrupted, its children are cancelled. Children are not limited
+// by the queue capacity, as their parent has already been accepted. It returns ErrInvalidTaskSpec
+// if any spec is invalid and ErrNotInHandler if ctx does not come from a task handler
+func SpawnChildren(ctx context.Context, specs ...model.TaskSpec) ([]int64, error) {
+	const op = "service.SpawnChildren"
+
+	sp, ok := ctx.Value(spawnerKey{}).(*spawner)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, ErrNotInHandler)
+	}
+	ids, err := sp.service.spawnChildren(ctx, sp.parentID, specs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	sp.mu.Lock()
+	sp.ids = append(sp.ids, ids...)
+	sp.mu.Unlock()
+	return ids, nil
+}
+
+// spawned returns IDs of the children created so far
+func (sp *spawner) spawned() []int64 {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return slices.Clone(sp.ids)
+}
+
+func (s *TaskService) spawnChildren(ctx context.Context, parentID int64, specs []model.TaskSpec) ([]int64, error) {
+	const op = "service.spawnChildren"
+	log := s.log.With(slog.String("op", op))
+
+	tasks, dependencies, err := s.newBatch(specs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tasks {
+		tasks[i].ParentID = &parentID
+	}
+	if err := s.checkDependencies(ctx, dependencies); err != nil {
+		return nil, err
+	}
+
+	ids, err := s.createBatch(ctx, tasks, len(dependencies) > 0)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+	log.Info("Spawned child tasks", slog.Int64("task_id", parentID), slog.Int("tasks_count", len(ids)))
+	return ids, nil
+}
+
+// GetTaskChildren returns tasks spawned by the task with taskID ordered by ID. It returns ErrTaskNotFound
+// if there is no such task
+func (s *TaskService) GetTaskChildren(ctx context.Context, taskID int64) ([]model.Task, error) {
+	const op = "service.GetTaskChildren"
+
+	if _, err := s.store.GetByID(ctx, taskID); err != nil {
+		if errors.Is(err, store.ErrTaskNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrTaskNotFound)
+		}
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	children, err := s.store.GetAll(ctx, model.TaskFilter{ParentID: &taskID})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	return children, nil
+}
+
+// cancelChildren cancels unfinished children of a cancelled task, and their children in turn
+func (s *TaskService) cancelChildren(ctx context.Context, taskID int64) {
+	const op = "service.cancelChildren"
+	log := s.log.With(slog.String("op", op))
+
+	children, err := s.store.GetAll(ctx, model.TaskFilter{
+		ParentID: &taskID,
+		States: []model.TaskState{
+			model.ScheduledState, model.WaitingState, model.PendingState, model.ProcessingState,
+			model.RetryingState, model.AwaitingChildrenState,
+		},
+	})
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	for _, child := range children {
+		s.cancelChild(ctx, child.ID)
+	}
+}
+
+// cancelSpawned cancels children spawned by an attempt which did not succeed. Its parent either failed
+// or will be handled again, so they would otherwise keep running detached from it
+func (s *TaskService) cancelSpawned(ctx context.Context, children *spawner) {
+	for _, id := range children.spawned() {
+		s.cancelChild(ctx, id)
+	}
+}
+
+func (s *TaskService) cancelChild(ctx context.Context, taskID int64) {
+	const op = "service.cancelChild"
+	log := s.log.With(slog.String("op", op))
+
+	// A child may finish in the meantime, there is nothing to cancel then
+	if _, err := s.CancelTask(ctx, taskID); err != nil && !errors.Is(err, ErrTaskFinished) {
+		log.Error(err.Error(), slog.Int64("task_id", taskID))
+	}
+}
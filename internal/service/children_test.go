@@ -0,0 +1,203 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io-load-api/internal/broker"
+	"io-load-api/internal/model"
+	"io-load-api/internal/service"
+	"io-load-api/internal/store"
+	"io-load-api/internal/worker"
+	"log/slog"
+	"testing"
+)
+
+func TestSpawnChildren_OutsideHandler(t *testing.T) {
+	_, err := service.SpawnChildren(context.Background(), model.TaskSpec{})
+
+	assert.ErrorIs(t, err, service.ErrNotInHandler)
+}
+
+func TestProcessTask_AwaitsChildren(t *testing.T) {
+	mockStore := new(MockStore)
+	mockPool := new(MockPool)
+	notifier := new(MockNotifier)
+	logger := slog.Default()
+
+	registry := service.NewRegistry()
+	_ = registry.Register("split", service.TaskHandlerFunc(func(ctx context.Context, task model.Task) (json.RawMessage, error) {
+		ids, err := service.SpawnChildren(ctx, model.TaskSpec{Type: "part"}, model.TaskSpec{Type: "part", Priority: 1})
+		assert.Equal(t, []int64{2, 3}, ids)
+		return json.RawMessage(`{"parts": 2}`), err
+	}))
+	_ = registry.Register("part", service.TaskHandlerFunc(func(context.Context, model.Task) (json.RawMessage, error) {
+		return nil, nil
+	}))
+	s := service.NewTaskService(logger, mockStore, mockPool, registry, broker.New(logger), notifier, cfg)
+
+	var handler worker.Handler
+	mockStore.On("ReleaseExpired", mock.Anything, mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockPool.On("Start", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		handler = args.Get(1).(worker.Handler)
+	}).Return()
+	mockPool.On("Stop", mock.Anything).Return(nil)
+	s.Start()
+	defer s.Stop(context.Background())
+
+	completed := model.Task{ID: 1, Type: "split", State: model.CompletedState}
+	mockStore.On("CreateBatch", mock.Anything, mock.MatchedBy(func(tasks []model.Task) bool {
+		return len(tasks) == 2 && *tasks[0].ParentID == 1 && *tasks[1].ParentID == 1 && tasks[1].Priority == 1
+	})).Return([]model.Task{{ID: 2, State: model.PendingState}, {ID: 3, State: model.PendingState}}, nil)
+	mockPool.On("Notify").Return().Twice()
+	mockStore.On("SaveAttempt", mock.Anything, mock.MatchedBy(func(task model.Task) bool {
+		return task.State == model.AwaitingChildrenState && task.ProcessEndedAt == nil &&
+			string(task.Result) == `{"parts": 2}`
+	}), mock.Anything).Return(nil)
+	mockStore.On("ResolveDependencies", mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	// Both children have already finished, so the parent completes right after it is handled
+	mockStore.On("CompleteParents", mock.Anything, mock.Anything).Return([]model.Task{completed}, nil).Once()
+	mockStore.On("CompleteParents", mock.Anything, mock.Anything).Return([]model.Task(nil), nil).Once()
+	notifier.On("Notify", completed).Return().Once()
+
+	handler(context.Background(), model.Task{ID: 1, Type: "split", State: model.ProcessingState, Attempts: 1})
+
+	mockStore.AssertExpectations(t)
+	mockPool.AssertNumberOfCalls(t, "Notify", 2)
+	notifier.AssertExpectations(t)
+}
+
+func TestProcessTask_CancelsChildrenOfFailedAttempt(t *testing.T) {
+	mockStore := new(MockStore)
+	mockPool := new(MockPool)
+	notifier := new(MockNotifier)
+	logger := slog.Default()
+
+	registry := service.NewRegistry()
+	_ = registry.Register("split", service.TaskHandlerFunc(func(ctx context.Context, task model.Task) (json.RawMessage, error) {
+		if _, err := service.SpawnChildren(ctx, model.TaskSpec{Type: "part"}, model.TaskSpec{Type: "part"}); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("split failed")
+	}))
+	_ = registry.Register("part", service.TaskHandlerFunc(func(context.Context, model.Task) (json.RawMessage, error) {
+		return nil, nil
+	}))
+	s := service.NewTaskService(logger, mockStore, mockPool, registry, broker.New(logger), notifier, cfg)
+
+	var handler worker.Handler
+	mockStore.On("ReleaseExpired", mock.Anything, mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockPool.On("Start", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		handler = args.Get(1).(worker.Handler)
+	}).Return()
+	mockPool.On("Stop", mock.Anything).Return(nil)
+	s.Start()
+	defer s.Stop(context.Background())
+
+	mockStore.On("CreateBatch", mock.Anything, mock.Anything).Return(
+		[]model.Task{{ID: 2, State: model.PendingState}, {ID: 3, State: model.PendingState}}, nil,
+	)
+	mockPool.On("Notify").Return()
+	mockStore.On("SaveAttempt", mock.Anything, mock.MatchedBy(func(task model.Task) bool {
+		return task.State == model.FailedState
+	}), 1).Return(nil)
+	notifier.On("Notify", mock.Anything).Return().Once()
+	mockStore.On("ResolveDependencies", mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockStore.On("CompleteParents", mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockStore.On("Cancel", mock.Anything, int64(2), mock.Anything).Return(model.Task{ID: 2, State: model.CancelledState}, nil).Once()
+	mockStore.On("GetAll", mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	// The second child finished before its parent failed
+	mockStore.On("Cancel", mock.Anything, int64(3), mock.Anything).Return(model.Task{}, store.ErrTaskFinished).Once()
+
+	handler(context.Background(), model.Task{
+		ID: 1, Type: "split", State: model.ProcessingState, Attempts: 1,
+		RetryPolicy: model.RetryPolicy{MaxAttempts: 1},
+	})
+
+	mockStore.AssertExpectations(t)
+	notifier.AssertExpectations(t)
+}
+
+func TestProcessTask_CancelsChildrenOfLostAttempt(t *testing.T) {
+	mockStore := new(MockStore)
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	registry := service.NewRegistry()
+	_ = registry.Register("split", service.TaskHandlerFunc(func(ctx context.Context, task model.Task) (json.RawMessage, error) {
+		_, err := service.SpawnChildren(ctx, model.TaskSpec{Type: "part"})
+		return nil, err
+	}))
+	_ = registry.Register("part", service.TaskHandlerFunc(func(context.Context, model.Task) (json.RawMessage, error) {
+		return nil, nil
+	}))
+	s := service.NewTaskService(logger, mockStore, mockPool, registry, broker.New(logger), newNotifier(), cfg)
+
+	var handler worker.Handler
+	mockStore.On("ReleaseExpired", mock.Anything, mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockPool.On("Start", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		handler = args.Get(1).(worker.Handler)
+	}).Return()
+	mockPool.On("Stop", mock.Anything).Return(nil)
+	s.Start()
+	defer s.Stop(context.Background())
+
+	mockStore.On("CreateBatch", mock.Anything, mock.Anything).Return([]model.Task{{ID: 2, State: model.PendingState}}, nil)
+	mockPool.On("Notify").Return()
+	// The task was recovered meanwhile, so the children of this attempt are orphans
+	mockStore.On("SaveAttempt", mock.Anything, mock.Anything, 1).Return(store.ErrLeaseLost)
+	mockStore.On("Cancel", mock.Anything, int64(2), mock.Anything).Return(model.Task{ID: 2, State: model.CancelledState}, nil).Once()
+	mockStore.On("GetAll", mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockStore.On("ResolveDependencies", mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockStore.On("CompleteParents", mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+
+	handler(context.Background(), model.Task{ID: 1, Type: "split", State: model.ProcessingState, Attempts: 1})
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestCancelTask_CancelsChildren(t *testing.T) {
+	mockStore := new(MockStore)
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, new(MockPool), newRegistry(), broker.New(logger), newNotifier(), cfg)
+
+	childrenOf := func(parentID int64) any {
+		return mock.MatchedBy(func(filter model.TaskFilter) bool {
+			return filter.ParentID != nil && *filter.ParentID == parentID && len(filter.States) > 0
+		})
+	}
+	mockStore.On("Cancel", mock.Anything, int64(1), mock.Anything).Return(model.Task{ID: 1, State: model.CancelledState}, nil)
+	mockStore.On("GetAll", mock.Anything, childrenOf(1)).Return([]model.Task{{ID: 2}, {ID: 3}}, nil)
+	mockStore.On("Cancel", mock.Anything, int64(2), mock.Anything).Return(model.Task{ID: 2, State: model.CancelledState}, nil)
+	mockStore.On("GetAll", mock.Anything, childrenOf(2)).Return([]model.Task(nil), nil)
+	// The second child finished before it was cancelled
+	mockStore.On("Cancel", mock.Anything, int64(3), mock.Anything).Return(model.Task{}, store.ErrTaskFinished)
+	mockStore.On("ResolveDependencies", mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockStore.On("CompleteParents", mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+
+	task, err := s.CancelTask(context.Background(), 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, model.CancelledState, task.State)
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetTaskChildren(t *testing.T) {
+	mockStore := newStore()
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, new(MockPool), newRegistry(), broker.New(logger), newNotifier(), cfg)
+
+	mockStore.On("GetByID", mock.Anything, int64(1)).Return(model.Task{ID: 1}, nil)
+	mockStore.On("GetByID", mock.Anything, int64(2)).Return(model.Task{}, store.ErrTaskNotFound)
+
+	children, err := s.GetTaskChildren(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Empty(t, children)
+
+	_, err = s.GetTaskChildren(context.Background(), 2)
+	assert.ErrorIs(t, err, service.ErrTaskNotFound)
+}
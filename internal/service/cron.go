@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io-load-api/internal/config"
+	"io-load-api/internal/model"
+	"io-load-api/internal/store"
+	"io-load-api/internal/utils/cron"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidSchedule  = errors.New("invalid schedule")
+	ErrScheduleNotFound = errors.New("schedule not found")
+)
+
+type ScheduleStore interface {
+	Create(ctx context.Context, schedule model.Schedule) (model.Schedule, error)
+	GetByID(ctx context.Context, scheduleID int64) (model.Schedule, error)
+	GetAll(ctx context.Context) ([]model.Schedule, error)
+	GetDue(ctx context.Context, now time.Time) ([]model.Schedule, error)
+	Delete(ctx context.Context, scheduleID int64) error
+	Fire(ctx context.Context, schedule model.Schedule, next time.Time, task model.Task) (model.Task, error)
+}
+
+// Leader reports whether this instance is the one which fires schedules
+type Leader interface {
+	IsLeader() bool
+}
+
+// ScheduleService keeps recurring schedules and, on the leader instance, creates tasks at their activations
+type ScheduleService struct {
+	log      *slog.Logger
+	store    ScheduleStore
+	tasks    *TaskService
+	leader   Leader
+	interval time.Duration
+
+	quit     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func NewScheduleService(
+	logger *slog.Logger,
+	store ScheduleStore,
+	tasks *TaskService,
+	leader Leader,
+	cfg *config.Config,
+) *ScheduleService {
+	return &ScheduleService{
+		log:      logger,
+		store:    store,
+		tasks:    tasks,
+		leader:   leader,
+		interval: cfg.Scheduler.CronInterval,
+		quit:     make(chan struct{}),
+	}
+}
+
+// Start checks schedules every cron interval in background until Stop is called
+func (s *ScheduleService) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.runCron()
+	}()
+}
+
+// Stop stops checking schedules and waits for the check in progress
+func (s *ScheduleService) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.quit)
+	})
+	s.wg.Wait()
+}
+
+// CreateSchedule stores a schedule which creates a task from template at every activation of the cron expression.
+// Expressions are evaluated in the local time zone. It returns ErrInvalidSchedule if the expression or the template
+// is invalid
+func (s *ScheduleService) CreateSchedule(ctx context.Context, expr string, template model.TaskSpec) (model.Schedule, error) {
+	const op = "service.CreateSchedule"
+	log := s.log.With(slog.String("op", op))
+
+	parsed, err := cron.Parse(expr)
+	if err != nil {
+		return model.Schedule{}, fmt.Errorf("%s: %w: %s", op, ErrInvalidSchedule, err)
+	}
+	switch {
+	case template.RunAt != nil:
+		return model.Schedule{}, fmt.Errorf("%s: %w: run_at is not supported in templates, use delay", op, ErrInvalidSchedule)
+	case template.Deadline != nil:
+		return model.Schedule{}, fmt.Errorf("%s: %w: deadline is not supported in templates", op, ErrInvalidSchedule)
+	case len(template.DependsOn) > 0:
+		return model.Schedule{}, fmt.Errorf("%s: %w: dependencies are not supported in templates", op, ErrInvalidSchedule)
+	case template.IdempotencyKey != "":
+		return model.Schedule{}, fmt.Errorf("%s: %w: idempotency keys are not supported in templates", op, ErrInvalidSchedule)
+	}
+	if _, err := s.tasks.newTask(template); err != nil {
+		return model.Schedule{}, fmt.Errorf("%s: %w: %w", op, ErrInvalidSchedule, err)
+	}
+	next := parsed.Next(time.Now())
+	if next.IsZero() {
+		return model.Schedule{}, fmt.Errorf("%s: %w: cron expression never fires", op, ErrInvalidSchedule)
+	}
+
+	schedule, err := s.store.Create(ctx, model.Schedule{Cron: expr, Template: template, NextRunAt: next})
+	if err != nil {
+		return model.Schedule{}, err
+	}
+	log.Info("Created schedule", slog.Int64("schedule_id", schedule.ID), slog.String("cron", expr))
+	return schedule, nil
+}
+
+func (s *ScheduleService) GetScheduleByID(ctx context.Context, id int64) (model.Schedule, error) {
+	schedule, err := s.store.GetByID(ctx, id)
+	if errors.Is(err, store.ErrScheduleNotFound) {
+		return model.Schedule{}, ErrScheduleNotFound
+	}
+	return schedule, err
+}
+
+func (s *ScheduleService) GetAllSchedules(ctx context.Context) ([]model.Schedule, error) {
+	return s.store.GetAll(ctx)
+}
+
+// DeleteSchedule stops a schedule. Tasks it has already created are kept
+func (s *ScheduleService) DeleteSchedule(ctx context.Context, id int64) error {
+	const op = "service.DeleteSchedule"
+
+	err := s.store.Delete(ctx, id)
+	if errors.Is(err, store.ErrScheduleNotFound) {
+		return ErrScheduleNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.log.Info("Deleted schedule", slog.String("op", op), slog.Int64("schedule_id", id))
+	return nil
+}
+
+// runCron fires due schedules every interval while this instance is the leader
+func (s *ScheduleService) runCron() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+			if s.leader.IsLeader() {
+				s.fireDueSchedules(context.Background())
+			}
+		}
+	}
+}
+
+// fireDueSchedules creates a task for every due schedule and moves the schedule to its next activation.
+// Activations missed while no instance was running are skipped, only one task is created for them
+func (s *ScheduleService) fireDueSchedules(ctx context.Context) {
+	const op = "service.fireDueSchedules"
+	log := s.log.With(slog.String("op", op))
+
+	if s.tasks.draining.Load() {
+		return
+	}
+	now := time.Now()
+	due, err := s.store.GetDue(ctx, now)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	for _, schedule := range due {
+		log := log.With(slog.Int64("schedule_id", schedule.ID))
+
+		parsed, err := cron.Parse(schedule.Cron)
+		if err != nil {
+			log.Error(err.Error())
+			continue
+		}
+		next := parsed.Next(now)
+		if next.IsZero() {
+			log.Warn("Schedule never fires again")
+			continue
+		}
+		task, err := s.tasks.newTask(schedule.Template)
+		if err != nil {
+			log.Error(err.Error())
+			continue
+		}
+
+		task, err = s.store.Fire(ctx, schedule, next, task)
+		if errors.Is(err, store.ErrScheduleNotDue) {
+			continue
+		}
+		if err != nil {
+			log.Error(err.Error())
+			continue
+		}
+		log.Info("Created task from schedule", slog.Int64("task_id", task.ID), slog.Time("next_run_at", next))
+		s.tasks.events.Publish(task)
+		if startsRightAway(task) {
+			s.tasks.pool.Notify()
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package service_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io-load-api/internal/broker"
+	"io-load-api/internal/model"
+	"io-load-api/internal/service"
+	"io-load-api/internal/store"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+type MockScheduleStore struct {
+	mock.Mock
+}
+
+func (m *MockScheduleStore) Create(ctx context.Context, schedule model.Schedule) (model.Schedule, error) {
+	args := m.Called(ctx, schedule)
+	return args.Get(0).(model.Schedule), args.Error(1)
+}
+
+func (m *MockScheduleStore) GetByID(ctx context.Context, scheduleID int64) (model.Schedule, error) {
+	args := m.Called(ctx, scheduleID)
+	return args.Get(0).(model.Schedule), args.Error(1)
+}
+
+func (m *MockScheduleStore) GetAll(ctx context.Context) ([]model.Schedule, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.Schedule), args.Error(1)
+}
+
+func (m *MockScheduleStore) GetDue(ctx context.Context, now time.Time) ([]model.Schedule, error) {
+	args := m.Called(ctx, now)
+	return args.Get(0).([]model.Schedule), args.Error(1)
+}
+
+func (m *MockScheduleStore) Delete(ctx context.Context, scheduleID int64) error {
+	args := m.Called(ctx, scheduleID)
+	return args.Error(0)
+}
+
+func (m *MockScheduleStore) Fire(
+	ctx context.Context,
+	schedule model.Schedule,
+	next time.Time,
+	task model.Task,
+) (model.Task, error) {
+	args := m.Called(ctx, schedule, next, task)
+	return args.Get(0).(model.Task), args.Error(1)
+}
+
+// leaderStub is the leader if its value is true
+type leaderStub bool
+
+func (l leaderStub) IsLeader() bool {
+	return bool(l)
+}
+
+func TestCreateSchedule(t *testing.T) {
+	mockStore := new(MockScheduleStore)
+	tasks := service.NewTaskService(slog.Default(), newStore(), new(MockPool), newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+	s := service.NewScheduleService(slog.Default(), mockStore, tasks, leaderStub(true), cfg)
+
+	template := model.TaskSpec{Priority: 5}
+	mockStore.On("Create", mock.Anything, mock.MatchedBy(func(schedule model.Schedule) bool {
+		return schedule.Cron == "@hourly" && schedule.Template.Priority == 5 &&
+			schedule.NextRunAt.After(time.Now()) && schedule.NextRunAt.Minute() == 0
+	})).Return(model.Schedule{ID: 1}, nil)
+
+	schedule, err := s.CreateSchedule(context.Background(), "@hourly", template)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), schedule.ID)
+	mockStore.AssertExpectations(t)
+}
+
+func TestCreateSchedule_Invalid(t *testing.T) {
+	mockStore := new(MockScheduleStore)
+	tasks := service.NewTaskService(slog.Default(), newStore(), new(MockPool), newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+	s := service.NewScheduleService(slog.Default(), mockStore, tasks, leaderStub(true), cfg)
+
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		expr     string
+		template model.TaskSpec
+	}{
+		{"every minute", model.TaskSpec{}},
+		{"0 0 30 2 *", model.TaskSpec{}},
+		{"* * * * *", model.TaskSpec{Type: "unknown"}},
+		{"* * * * *", model.TaskSpec{RunAt: &future}},
+		{"* * * * *", model.TaskSpec{Deadline: &future}},
+	}
+	for _, tt := range tests {
+		_, err := s.CreateSchedule(context.Background(), tt.expr, tt.template)
+		assert.ErrorIs(t, err, service.ErrInvalidSchedule, tt.expr)
+	}
+	mockStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestDeleteSchedule_NotFound(t *testing.T) {
+	mockStore := new(MockScheduleStore)
+	tasks := service.NewTaskService(slog.Default(), newStore(), new(MockPool), newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+	s := service.NewScheduleService(slog.Default(), mockStore, tasks, leaderStub(true), cfg)
+
+	mockStore.On("Delete", mock.Anything, int64(1)).Return(store.ErrScheduleNotFound)
+
+	assert.ErrorIs(t, s.DeleteSchedule(context.Background(), 1), service.ErrScheduleNotFound)
+}
+
+func TestScheduleService_FiresDueSchedules(t *testing.T) {
+	mockStore := new(MockScheduleStore)
+	mockPool := new(MockPool)
+	events := broker.New(slog.Default())
+	tasks := service.NewTaskService(slog.Default(), newStore(), mockPool, newRegistry(), events, newNotifier(), cfg)
+
+	cronCfg := *cfg
+	cronCfg.Scheduler.CronInterval = 10 * time.Millisecond
+	s := service.NewScheduleService(slog.Default(), mockStore, tasks, leaderStub(true), &cronCfg)
+
+	changes, unsubscribe := events.Subscribe(10)
+	defer unsubscribe()
+
+	due := model.Schedule{ID: 1, Cron: "* * * * *", Template: model.TaskSpec{Priority: 3}, NextRunAt: time.Now()}
+	mockStore.On("GetDue", mock.Anything, mock.Anything).Return([]model.Schedule{due}, nil).Once()
+	mockStore.On("GetDue", mock.Anything, mock.Anything).Return([]model.Schedule(nil), nil)
+	mockStore.On("Fire", mock.Anything, due, mock.MatchedBy(func(next time.Time) bool {
+		return next.After(due.NextRunAt) && next.Second() == 0
+	}), mock.MatchedBy(func(task model.Task) bool {
+		return task.Type == service.SimulateIOTaskType && task.Priority == 3
+	})).Return(model.Task{ID: 10, State: model.PendingState}, nil).Once()
+	mockPool.On("Notify").Return().Once()
+
+	s.Start()
+	select {
+	case task := <-changes:
+		assert.Equal(t, int64(10), task.ID)
+	case <-time.After(time.Second):
+		t.Fatal("task created from schedule was not published")
+	}
+	s.Stop()
+
+	mockStore.AssertExpectations(t)
+	mockPool.AssertExpectations(t)
+}
+
+func TestScheduleService_FollowerDoesNotFire(t *testing.T) {
+	mockStore := new(MockScheduleStore)
+	tasks := service.NewTaskService(slog.Default(), newStore(), new(MockPool), newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+
+	cronCfg := *cfg
+	cronCfg.Scheduler.CronInterval = time.Millisecond
+	s := service.NewScheduleService(slog.Default(), mockStore, tasks, leaderStub(false), &cronCfg)
+
+	s.Start()
+	time.Sleep(20 * time.Millisecond)
+	s.Stop()
+
+	mockStore.AssertNotCalled(t, "GetDue", mock.Anything, mock.Anything)
+}
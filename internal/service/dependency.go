@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io-load-api/internal/metrics"
+	"io-load-api/internal/model"
+	"io-load-api/internal/store"
+	"log/slog"
+	"time"
+)
+
+// checkDependencies returns ErrInvalidTaskSpec if some of tasks with parentIDs does not exist
+func (s *TaskService) checkDependencies(ctx context.Context, parentIDs []int64) error {
+	checked := make(map[int64]bool, len(parentIDs))
+	for _, parentID := range parentIDs {
+		if checked[parentID] {
+			continue
+		}
+		_, err := s.store.GetByID(ctx, parentID)
+		if errors.Is(err, store.ErrTaskNotFound) {
+			return fmt.Errorf("%w: task %d it depends on does not exist", ErrInvalidTaskSpec, parentID)
+		}
+		if err != nil {
+			return err
+		}
+		checked[parentID] = true
+	}
+	return nil
+}
+
+// resolveDependencies releases waiting tasks whose dependencies have completed and fails the ones with a dependency
+// which did not, then completes parents whose children have all finished. A failed or completed task may in turn
+// resolve the tasks depending on it or complete its own parent, so it repeats until nothing finishes
+func (s *TaskService) resolveDependencies(ctx context.Context) {
+	const op = "service.resolveDependencies"
+	log := s.log.With(slog.String("op", op))
+
+	for {
+		resolved, err := s.store.ResolveDependencies(ctx, time.Now())
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		completed, err := s.store.CompleteParents(ctx, time.Now())
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		if len(resolved) > 0 {
+			log.Info("Resolved task dependencies", slog.Int("tasks_count", len(resolved)))
+		}
+		if len(completed) > 0 {
+			log.Info("Completed parent tasks", slog.Int("tasks_count", len(completed)))
+		}
+
+		finished := false
+		for _, task := range append(resolved, completed...) {
+			s.events.Publish(task)
+			switch {
+			case task.State == model.PendingState:
+				s.pool.Notify()
+			case task.State.Finished():
+				finished = true
+				s.webhooks.Notify(task)
+				metrics.TaskProcessed.WithLabelValues(string(task.State)).Inc()
+			}
+		}
+		if !finished {
+			return
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io-load-api/internal/model"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+)
+
+// cursor is the position after which the next page starts. It is passed to clients base64 encoded
+type cursor struct {
+	LastID int64 `json:"last_id"`
+}
+
+func encodeCursor(lastID int64) string {
+	data, _ := json.Marshal(cursor{LastID: lastID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(encoded string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor{}, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return cursor{}, err
+	}
+	if c.LastID <= 0 {
+		return cursor{}, fmt.Errorf("cursor points to task ID %d", c.LastID)
+	}
+	return c, nil
+}
+
+// newTaskFilter converts client query into store filter
+func newTaskFilter(query model.TaskQuery) (model.TaskFilter, error) {
+	filter := model.TaskFilter{
+		States:     query.States,
+		Descending: query.Descending,
+		Limit:      query.Limit,
+	}
+	// Timestamps are stored without time zone in local time
+	if query.CreatedAfter != nil {
+		createdAfter := query.CreatedAfter.Local()
+		filter.CreatedAfter = &createdAfter
+	}
+	if query.CreatedBefore != nil {
+		createdBefore := query.CreatedBefore.Local()
+		filter.CreatedBefore = &createdBefore
+	}
+
+	switch {
+	case filter.Limit == 0:
+		filter.Limit = defaultPageSize
+	case filter.Limit < 0 || filter.Limit > maxPageSize:
+		return model.TaskFilter{}, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, maxPageSize)
+	}
+
+	if query.Cursor != "" {
+		c, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return model.TaskFilter{}, fmt.Errorf("%w: invalid cursor", ErrInvalidQuery)
+		}
+		filter.AfterID = c.LastID
+	}
+	return filter, nil
+}
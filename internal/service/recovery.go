@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io-load-api/internal/config"
+	"io-load-api/internal/metrics"
+	"io-load-api/internal/model"
+	"io-load-api/internal/store"
+	"log/slog"
+	"time"
+)
+
+// Recovery policies applied to tasks whose lease has expired
+const (
+	RequeuePolicy = config.RequeuePolicy
+	FailPolicy    = config.FailPolicy
+)
+
+// heartbeat extends the lease of the processing attempt of task until ctx is cancelled.
+// If the attempt no longer holds the task, e.g. it was cancelled or recovered by another instance, it cancels the task
+func (s *TaskService) heartbeat(ctx context.Context, task model.Task, cancel context.CancelCauseFunc) {
+	const op = "service.heartbeat"
+	log := s.log.With(slog.String("op", op))
+
+	ticker := time.NewTicker(s.recovery.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.store.ExtendLease(ctx, task.ID, task.Attempts, s.recovery.LeaseDuration)
+			if errors.Is(err, store.ErrLeaseLost) {
+				cancel(errLeaseLost)
+				return
+			}
+			if err != nil && ctx.Err() == nil {
+				log.Warn("Failed to extend task lease", slog.Int64("task_id", task.ID), slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// runReaper recovers expired tasks every reap interval until the service is stopped
+func (s *TaskService) runReaper() {
+	ticker := time.NewTicker(s.recovery.ReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+			s.recoverExpiredTasks(context.Background())
+		}
+	}
+}
+
+// recoverExpiredTasks requeues or fails processing tasks whose lease has expired, e.g. because
+// the instance processing them has crashed
+func (s *TaskService) recoverExpiredTasks(ctx context.Context) {
+	const op = "service.recoverExpiredTasks"
+	log := s.log.With(slog.String("op", op))
+
+	state := model.PendingState
+	if s.recovery.Policy == FailPolicy {
+		state = model.FailedState
+	}
+
+	released, err := s.store.ReleaseExpired(ctx, time.Now(), state)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	if len(released) == 0 {
+		return
+	}
+
+	log.Info("Recovered tasks with expired lease", slog.Int("tasks_count", len(released)), slog.String("state", string(state)))
+	for _, task := range released {
+		s.events.Publish(task)
+		if task.State == model.FailedState {
+			s.webhooks.Notify(task)
+			metrics.TaskProcessed.WithLabelValues(string(task.State)).Inc()
+		}
+	}
+	if state == model.FailedState {
+		// Tasks depending on the failed ones fail in turn
+		s.resolveDependencies(ctx)
+	} else {
+		s.pool.Notify()
+	}
+}
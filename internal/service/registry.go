@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io-load-api/internal/model"
+	"sort"
+	"sync"
+)
+
+// SimulateIOTaskType is the type of tasks created without explicit type
+const SimulateIOTaskType = "simulate_io"
+
+// TaskHandler executes tasks of a single type. It reads input from task.Payload and returns
+// JSON result which is stored with the completed task. Returned error fails the attempt
+type TaskHandler interface {
+	Handle(ctx context.Context, task model.Task) (json.RawMessage, error)
+}
+
+// TaskHandlerFunc adapts an ordinary function to TaskHandler
+type TaskHandlerFunc func(ctx context.Context, task model.Task) (json.RawMessage, error)
+
+func (f TaskHandlerFunc) Handle(ctx context.Context, task model.Task) (json.RawMessage, error) {
+	return f(ctx, task)
+}
+
+// TaskError lets a handler report a failure with its own error code.
+// Errors of other types are stored with model.HandlerErrorCode
+type TaskError struct {
+	Code string
+	Err  error
+}
+
+func NewTaskError(code string, err error) *TaskError {
+	return &TaskError{Code: code, Err: err}
+}
+
+func (e *TaskError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TaskError) Unwrap() error {
+	return e.Err
+}
+
+// errorCode returns code of TaskError wrapped into err or model.HandlerErrorCode
+func errorCode(err error) string {
+	var taskErr *TaskError
+	if errors.As(err, &taskErr) && taskErr.Code != "" {
+		return taskErr.Code
+	}
+	return model.HandlerErrorCode
+}
+
+// Registry maps task types to handlers which execute them
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[string]TaskHandler
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers: make(map[string]TaskHandler),
+	}
+}
+
+// Register adds handler for taskType. It returns error if the type is empty or already registered
+func (r *Registry) Register(taskType string, handler TaskHandler) error {
+	if taskType == "" {
+		return fmt.Errorf("task type must not be empty")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.handlers[taskType]; exists {
+		return fmt.Errorf("handler for task type %q is already registered", taskType)
+	}
+	r.handlers[taskType] = handler
+	return nil
+}
+
+// Handler returns handler registered for taskType
+func (r *Registry) Handler(taskType string) (TaskHandler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	handler, ok := r.handlers[taskType]
+	return handler, ok
+}
+
+// Types returns sorted list of registered task types
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.handlers))
+	for taskType := range r.handlers {
+		types = append(types, taskType)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,27 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io-load-api/internal/model"
+	"io-load-api/internal/service"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := service.NewRegistry()
+	noop := service.TaskHandlerFunc(func(context.Context, model.Task) (json.RawMessage, error) { return nil, nil })
+
+	assert.NoError(t, registry.Register("resize_image", noop))
+	assert.NoError(t, registry.Register("fetch_url", noop))
+	assert.Error(t, registry.Register("fetch_url", noop))
+	assert.Error(t, registry.Register("", noop))
+
+	_, ok := registry.Handler("fetch_url")
+	assert.True(t, ok)
+	_, ok = registry.Handler("unknown")
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{"fetch_url", "resize_image"}, registry.Types())
+}
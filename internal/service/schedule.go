@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// runPromoter makes due scheduled tasks pending and resolves dependencies every promote interval until the service
+// is stopped. Dependencies are also resolved right after tasks finish, the periodic pass catches tasks finished
+// by other means, such as lease expiration under the fail policy
+func (s *TaskService) runPromoter() {
+	ticker := time.NewTicker(s.scheduler.PromoteInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+			s.promoteDueTasks(context.Background())
+			s.resolveDependencies(context.Background())
+		}
+	}
+}
+
+// promoteDueTasks moves scheduled tasks whose run time has come to pending state and wakes up workers to claim them
+func (s *TaskService) promoteDueTasks(ctx context.Context) {
+	const op = "service.promoteDueTasks"
+	log := s.log.With(slog.String("op", op))
+
+	promoted, err := s.store.PromoteDue(ctx, time.Now())
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	if len(promoted) == 0 {
+		return
+	}
+
+	log.Info("Promoted scheduled tasks", slog.Int("tasks_count", len(promoted)))
+	for _, task := range promoted {
+		s.events.Publish(task)
+		s.pool.Notify()
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io-load-api/internal/model"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// MaxDependencies is the largest number of tasks a task may depend on
+const MaxDependencies = 100
+
+// newTask builds a task from client spec, filling in defaults from config.
+// It returns ErrInvalidTaskSpec if some option is out of range
+func (s *TaskService) newTask(spec model.TaskSpec) (model.Task, error) {
+	task := model.Task{
+		Type:        spec.Type,
+		Priority:    spec.Priority,
+		RetryPolicy: s.retryPolicy,
+		Timeout:     spec.Timeout,
+		Payload:     spec.Payload,
+		CallbackURL: spec.CallbackURL,
+	}
+	if spec.IdempotencyKey != "" {
+		task.IdempotencyKey = spec.IdempotencyKey
+		task.RequestHash = specHash(spec)
+	}
+	if task.Type == "" {
+		task.Type = SimulateIOTaskType
+	}
+	if _, ok := s.registry.Handler(task.Type); !ok {
+		return model.Task{}, fmt.Errorf("%w: unknown task type %q", ErrInvalidTaskSpec, task.Type)
+	}
+	if spec.Deadline != nil {
+		// Timestamps are stored without time zone in local time, as the ones taken from time.Now
+		deadline := spec.Deadline.Local()
+		task.Deadline = &deadline
+	}
+	if spec.RunAt != nil && spec.Delay != 0 {
+		return model.Task{}, fmt.Errorf("%w: run_at and delay are mutually exclusive", ErrInvalidTaskSpec)
+	}
+	if spec.Delay < 0 {
+		return model.Task{}, fmt.Errorf("%w: delay must not be negative", ErrInvalidTaskSpec)
+	}
+	now := time.Now()
+	var runAt *time.Time
+	switch {
+	case spec.RunAt != nil:
+		local := spec.RunAt.Local()
+		runAt = &local
+	case spec.Delay > 0:
+		delayed := now.Add(spec.Delay)
+		runAt = &delayed
+	}
+	// Tasks due already start right away, the rest wait in scheduled state for the promoter
+	if runAt != nil && runAt.After(now) {
+		task.RunAt = runAt
+		task.State = model.ScheduledState
+	}
+	if len(spec.DependsOn) > MaxDependencies {
+		return model.Task{}, fmt.Errorf("%w: a task may depend on at most %d tasks", ErrInvalidTaskSpec, MaxDependencies)
+	}
+	for _, parentID := range spec.DependsOn {
+		if parentID <= 0 {
+			return model.Task{}, fmt.Errorf("%w: invalid dependency ID %d", ErrInvalidTaskSpec, parentID)
+		}
+		if !slices.Contains(task.DependsOn, parentID) {
+			task.DependsOn = append(task.DependsOn, parentID)
+		}
+	}
+	// Waiting tasks keep their run time and become scheduled if it has not come when dependencies complete
+	if len(task.DependsOn) > 0 {
+		task.State = model.WaitingState
+	}
+
+	if spec.RetryPolicy != nil {
+		policy := *spec.RetryPolicy
+		if policy.MaxAttempts == 0 {
+			policy.MaxAttempts = s.retryPolicy.MaxAttempts
+		}
+		if policy.BaseDelay == 0 {
+			policy.BaseDelay = s.retryPolicy.BaseDelay
+		}
+		if policy.Multiplier == 0 {
+			policy.Multiplier = s.retryPolicy.Multiplier
+		}
+		task.RetryPolicy = policy
+	}
+
+	policy := task.RetryPolicy
+	switch {
+	case policy.MaxAttempts < 1:
+		return model.Task{}, fmt.Errorf("%w: max attempts must be at least 1", ErrInvalidTaskSpec)
+	case policy.BaseDelay < 0:
+		return model.Task{}, fmt.Errorf("%w: base delay must not be negative", ErrInvalidTaskSpec)
+	case policy.Multiplier < 1:
+		return model.Task{}, fmt.Errorf("%w: multiplier must be at least 1", ErrInvalidTaskSpec)
+	case policy.Jitter < 0 || policy.Jitter > 1:
+		return model.Task{}, fmt.Errorf("%w: jitter must be between 0 and 1", ErrInvalidTaskSpec)
+	case task.Priority < model.MinPriority || task.Priority > model.MaxPriority:
+		return model.Task{}, fmt.Errorf(
+			"%w: priority must be between %d and %d", ErrInvalidTaskSpec, model.MinPriority, model.MaxPriority,
+		)
+	case task.Timeout < 0:
+		return model.Task{}, fmt.Errorf("%w: timeout must not be negative", ErrInvalidTaskSpec)
+	case task.Deadline != nil && !task.Deadline.After(now):
+		return model.Task{}, fmt.Errorf("%w: deadline must be in the future", ErrInvalidTaskSpec)
+	case task.Deadline != nil && task.RunAt != nil && !task.Deadline.After(*task.RunAt):
+		return model.Task{}, fmt.Errorf("%w: deadline must be after run_at", ErrInvalidTaskSpec)
+	case task.CallbackURL != "" && !validCallbackURL(task.CallbackURL):
+		return model.Task{}, fmt.Errorf("%w: callback URL must be an absolute http or https URL", ErrInvalidTaskSpec)
+	case task.CallbackURL != "" && s.callbackHosts.CheckHost(callbackHost(task.CallbackURL)) != nil:
+		return model.Task{}, fmt.Errorf("%w: callback URL must not point to an internal address", ErrInvalidTaskSpec)
+	}
+	return task, nil
+}
+
+// startsRightAway reports whether task is pending as soon as it is stored
+func startsRightAway(task model.Task) bool {
+	return task.State != model.ScheduledState && task.State != model.WaitingState
+}
+
+func validCallbackURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// callbackHost returns the host of a valid callback URL without the port
+func callbackHost(rawURL string) string {
+	parsed, _ := url.Parse(rawURL)
+	return parsed.Hostname()
+}
+
+// specHash returns a fingerprint of spec which is the same for repeated requests
+func specHash(spec model.TaskSpec) string {
+	spec.IdempotencyKey = ""
+	data, _ := json.Marshal(spec)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
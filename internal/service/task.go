@@ -2,115 +2,423 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io-load-api/internal/config"
 	"io-load-api/internal/metrics"
 	"io-load-api/internal/model"
-	"io-load-api/internal/utils/io"
+	"io-load-api/internal/store"
+	"io-load-api/internal/utils/backoff"
+	"io-load-api/internal/webhook"
+	"io-load-api/internal/worker"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var (
+	ErrQueueFull       = errors.New("too many tasks in queue")
+	ErrInvalidTaskSpec = errors.New("invalid task spec")
+	ErrTaskNotFound    = errors.New("task not found")
+	ErrTaskFinished    = errors.New("task is already finished")
+	ErrShuttingDown    = errors.New("service is shutting down")
+	ErrInvalidQuery    = errors.New("invalid task query")
+	// ErrIdempotencyConflict means the idempotency key was already used for a different request
+	ErrIdempotencyConflict = errors.New("idempotency key is already used for a different request")
+)
+
 type Store interface {
-	Create(ctx context.Context) (model.Task, error)
+	Create(ctx context.Context, task model.Task) (model.Task, error)
+	CreateBatch(ctx context.Context, tasks []model.Task) ([]model.Task, error)
+	CreateWorkflow(ctx context.Context, tasks []model.Task, dependencies [][]int) ([]model.Task, error)
 	GetByID(ctx context.Context, taskID int64) (model.Task, error)
-	GetAll(ctx context.Context) ([]model.Task, error)
+	GetByIdempotencyKey(ctx context.Context, key string) (model.Task, error)
+	GetAll(ctx context.Context, filter model.TaskFilter) ([]model.Task, error)
 	Update(ctx context.Context, task model.Task) error
+	SaveAttempt(ctx context.Context, task model.Task, attempt int) error
+	Claim(ctx context.Context, lease time.Duration, types []string, aging time.Duration) (model.Task, error)
+	ExtendLease(ctx context.Context, taskID int64, attempt int, lease time.Duration) error
+	ReleaseExpired(ctx context.Context, now time.Time, state model.TaskState) ([]model.Task, error)
+	CountByState(ctx context.Context, state model.TaskState) (int, error)
+	Cancel(ctx context.Context, taskID int64, now time.Time) (model.Task, error)
+	PromoteDue(ctx context.Context, now time.Time) ([]model.Task, error)
+	ResolveDependencies(ctx context.Context, now time.Time) ([]model.Task, error)
+	CompleteParents(ctx context.Context, now time.Time) ([]model.Task, error)
 }
 
-// TaskService runs task processes using task store
+// Publisher notifies subscribers about task state changes
+type Publisher interface {
+	Publish(task model.Task)
+}
+
+// Notifier sends webhooks about completed and failed tasks
+type Notifier interface {
+	Notify(task model.Task)
+}
+
+type Pool interface {
+	Start(claim worker.ClaimFunc, handler worker.Handler)
+	Notify()
+	Stop(ctx context.Context) error
+}
+
+// TaskService runs task processes using task store and worker pool
 type TaskService struct {
-	log   *slog.Logger
-	store Store
+	log           *slog.Logger
+	store         Store
+	pool          Pool
+	registry      *Registry
+	events        Publisher
+	webhooks      Notifier
+	queueCapacity int
+	recovery      config.Recovery
+	scheduler     config.Scheduler
+	retryPolicy   model.RetryPolicy
+	callbackHosts webhook.HostPolicy
+
+	// running holds cancel functions of tasks processed by this instance
+	mu      sync.Mutex
+	running map[int64]context.CancelCauseFunc
+
+	draining atomic.Bool
+	quit     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
 }
 
-func NewTaskService(logger *slog.Logger, store Store) *TaskService {
+func NewTaskService(
+	logger *slog.Logger,
+	store Store,
+	pool Pool,
+	registry *Registry,
+	events Publisher,
+	webhooks Notifier,
+	cfg *config.Config,
+) *TaskService {
 	return &TaskService{
-		log:   logger,
-		store: store,
+		log:           logger,
+		store:         store,
+		pool:          pool,
+		registry:      registry,
+		events:        events,
+		webhooks:      webhooks,
+		queueCapacity: cfg.WorkerPool.QueueCapacity,
+		recovery:      cfg.Recovery,
+		scheduler:     cfg.Scheduler,
+		retryPolicy: model.RetryPolicy{
+			MaxAttempts: cfg.Retry.MaxAttempts,
+			BaseDelay:   cfg.Retry.BaseDelay,
+			Multiplier:  cfg.Retry.Multiplier,
+			Jitter:      cfg.Retry.Jitter,
+		},
+		callbackHosts: webhook.NewHostPolicy(cfg.Webhook.AllowedHosts),
+		running:       make(map[int64]context.CancelCauseFunc),
+		quit:          make(chan struct{}),
 	}
 }
 
-// GetAllTasks returns a slice of all tasks in store.
-func (s *TaskService) GetAllTasks(ctx context.Context) ([]model.Task, error) {
+// Start recovers tasks left with expired leases, then runs workers which claim pending tasks
+// from the store, a reaper which periodically recovers expired tasks and a promoter which makes due scheduled tasks pending
+func (s *TaskService) Start() {
+	s.recoverExpiredTasks(context.Background())
+	s.pool.Start(s.claimTask, s.processTask)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.runReaper()
+	}()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.runPromoter()
+	}()
+}
+
+// Stop rejects new tasks, stops background loops and waits for running tasks until ctx expires.
+// Tasks interrupted after that are requeued
+func (s *TaskService) Stop(ctx context.Context) error {
+	s.draining.Store(true)
+	s.stopOnce.Do(func() {
+		close(s.quit)
+	})
+	s.wg.Wait()
+	return s.pool.Stop(ctx)
+}
+
+// GetAllTasks returns a page of tasks matching query and the cursor of the next page.
+// It returns ErrInvalidQuery if the cursor or the limit is invalid
+func (s *TaskService) GetAllTasks(ctx context.Context, query model.TaskQuery) (model.TaskPage, error) {
 	const op = "service.GetAllTasks"
 	log := s.log.With(slog.String("op", op))
 
-	tasks, err := s.store.GetAll(ctx)
+	filter, err := newTaskFilter(query)
+	if err != nil {
+		return model.TaskPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// One extra task tells whether there is a next page
+	limit := filter.Limit
+	filter.Limit++
+	tasks, err := s.store.GetAll(ctx, filter)
 	if err != nil {
 		log.Error(err.Error())
-		return nil, fmt.Errorf("%s: %s", op, err)
+		return model.TaskPage{}, fmt.Errorf("%s: %s", op, err)
 	}
-	return tasks, nil
+
+	page := model.TaskPage{Tasks: tasks}
+	if len(tasks) > limit {
+		page.Tasks = tasks[:limit]
+		page.NextCursor = encodeCursor(page.Tasks[limit-1].ID)
+	}
+	return page, nil
 }
 
-// GetTaskByID finds and returns a task by its ID. If task is not found it returns error
+// GetTaskByID finds and returns a task by its ID. If task is not found it returns ErrTaskNotFound
 func (s *TaskService) GetTaskByID(ctx context.Context, taskID int64) (model.Task, error) {
 	const op = "service.GetTaskByID"
 	log := s.log.With(slog.String("op", op))
 
 	log.Debug("Getting task by ID", slog.Int64("task_id", taskID))
 	task, err := s.store.GetByID(ctx, taskID)
+	if errors.Is(err, store.ErrTaskNotFound) {
+		return model.Task{}, fmt.Errorf("%s: %w", op, ErrTaskNotFound)
+	}
 	if err != nil {
-		return model.Task{}, errors.New("task not found")
-	} else {
-		log.Debug("Task found", slog.Int64("task_id", taskID))
-		return task, nil
+		log.Error(err.Error())
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
 	}
+	log.Debug("Task found", slog.Int64("task_id", taskID))
+	return task, nil
 }
 
-// CreateTask creates and runs a new IO Task in separate goroutine
-func (s *TaskService) CreateTask(ctx context.Context) (int64, error) {
+// CreateTask creates a new pending IO Task from spec and wakes up a worker to claim it.
+// A task with a run time in the future is created in scheduled state and becomes pending when it is due,
+// a task with dependencies waits until they complete.
+// If spec is invalid it returns ErrInvalidTaskSpec, if there are already too many pending tasks it returns ErrQueueFull.
+// If a task was already created with the same idempotency key, its ID is returned instead,
+// or ErrIdempotencyConflict if that task was created from a different spec
+func (s *TaskService) CreateTask(ctx context.Context, spec model.TaskSpec) (int64, error) {
 	const op = "service.CreateTask"
 	log := s.log.With(slog.String("op", op))
 
-	log.Debug("Creating new task")
-	task, err := s.store.Create(ctx)
+	if s.draining.Load() {
+		return -1, fmt.Errorf("%s: %w", op, ErrShuttingDown)
+	}
+
+	task, err := s.newTask(spec)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if task.IdempotencyKey != "" {
+		existing, err := s.store.GetByIdempotencyKey(ctx, task.IdempotencyKey)
+		if err == nil {
+			return replayedTaskID(op, existing, task)
+		}
+		if !errors.Is(err, store.ErrTaskNotFound) {
+			return -1, err
+		}
+	}
+
+	if err := s.checkDependencies(ctx, task.DependsOn); err != nil {
+		return -1, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pending, err := s.store.CountByState(ctx, model.PendingState)
 	if err != nil {
 		return -1, err
 	}
+	if pending >= s.queueCapacity {
+		log.Warn("Task queue is full", slog.Int("pending_tasks", pending))
+		return -1, fmt.Errorf("%s: %w", op, ErrQueueFull)
+	}
 
-	log.Info("Created task with ID", slog.Int64("task_id", task.ID))
+	log.Debug("Creating new task")
+	created, err := s.store.Create(ctx, task)
+	if errors.Is(err, store.ErrDuplicateKey) {
+		// Concurrent request with the same key has created the task first
+		return replayedTaskID(op, created, task)
+	}
+	if err != nil {
+		return -1, err
+	}
+	task = created
 
-	// Go processing task
-	go s.processTask(context.Background(), task)
+	log.Info("Created task with ID", slog.Int64("task_id", task.ID), slog.String("state", string(task.State)))
+	s.events.Publish(task)
+	switch {
+	case startsRightAway(task):
+		s.pool.Notify()
+	case task.State == model.WaitingState:
+		// Dependencies may have finished before the task was stored
+		s.resolveDependencies(ctx)
+	}
 
 	return task.ID, nil
 }
 
+// replayedTaskID returns the ID of existing task created with the same idempotency key as task
+func replayedTaskID(op string, existing, task model.Task) (int64, error) {
+	if existing.RequestHash != task.RequestHash {
+		return -1, fmt.Errorf("%s: %w", op, ErrIdempotencyConflict)
+	}
+	return existing.ID, nil
+}
+
+// claimTask claims only tasks of types this instance has handlers for, highest priority first
+func (s *TaskService) claimTask(ctx context.Context) (model.Task, error) {
+	task, err := s.store.Claim(ctx, s.recovery.LeaseDuration, s.registry.Types(), s.scheduler.AgingInterval)
+	if err != nil {
+		return model.Task{}, err
+	}
+	s.events.Publish(task)
+	return task, nil
+}
+
 func (s *TaskService) processTask(ctx context.Context, task model.Task) {
 	const op = "service.processTask"
 	log := s.log.With(slog.String("op", op))
 
-	log.Info("Processing task", slog.Int64("task_id", task.ID))
-	startTime := time.Now()
-	task.State = model.ProcessingState
-	task.ProcessStartedAt = &startTime
-	err := s.store.Update(context.Background(), task)
-	if err != nil {
-		log.Error(err.Error())
+	log.Info("Processing task", slog.Int64("task_id", task.ID), slog.String("type", task.Type))
+	metrics.ActiveTasks.Inc()
+	defer metrics.ActiveTasks.Dec()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	s.track(task.ID, cancel)
+	defer s.untrack(task.ID)
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	go s.heartbeat(heartbeatCtx, task, cancel)
+
+	handler, ok := s.registry.Handler(task.Type)
+	if !ok {
+		// Claim filters by registered types, so this means the registry was changed after start
+		handler = TaskHandlerFunc(func(context.Context, model.Task) (json.RawMessage, error) {
+			return nil, NewTaskError(
+				model.UnknownTypeErrorCode,
+				fmt.Errorf("no handler registered for task type %q", task.Type),
+			)
+		})
+	}
+
+	execCtx, stopTimer := withTaskDeadline(ctx, task)
+	execCtx, children := s.withSpawner(execCtx, task)
+	result, err := handler.Handle(execCtx, task)
+	cause := context.Cause(execCtx)
+	stopTimer()
+	stopHeartbeat()
+
+	// Children belong to the attempt which spawned them, they are kept only if its success is stored
+	keepChildren := false
+	defer func() {
+		if !keepChildren {
+			s.cancelSpawned(context.Background(), children)
+		}
+	}()
+
+	// Cancelled or recovered task has already been moved out of processing state in the store
+	if errors.Is(cause, errTaskCancelled) || errors.Is(cause, errLeaseLost) {
+		log.Info("Stopped processing task", slog.Int64("task_id", task.ID), slog.String("reason", cause.Error()))
 		return
 	}
-	metrics.ActiveTasks.Inc()
 
-	// IO Processing
-	err = io.SimulateIOProcessing(ctx)
+	// The outcome is stored only while this attempt still holds the task
+	attempt := task.Attempts
+
+	// Task interrupted by shutdown goes back to the queue without counting the attempt. A handler which
+	// succeeded regardless has done its job, so its outcome is stored as usual
+	if err != nil && errors.Is(cause, worker.ErrShutdown) {
+		task.State = model.PendingState
+		task.ProcessStartedAt = nil
+		task.LeaseExpiresAt = nil
+		task.Attempts--
+		if err := s.saveAttempt(task, attempt); err != nil {
+			return
+		}
+		s.events.Publish(task)
+		log.Info("Requeued task interrupted by shutdown", slog.Int64("task_id", task.ID))
+		return
+	}
 
 	// Change state
 	endTime := time.Now()
-	if err != nil {
-		task.State = model.FailedState
-		log.Info("Failed to process task", slog.Int64("task_id", task.ID))
-	} else {
+	task.LeaseExpiresAt = nil
+	task.Error, task.ErrorCode = "", ""
+	switch {
+	case err == nil && len(children.spawned()) > 0:
+		task.State = model.AwaitingChildrenState
+		task.Result = result
+		log.Info("Handled task, waiting for its children", slog.Int64("task_id", task.ID))
+	case err == nil:
 		task.State = model.CompletedState
+		task.ProcessEndedAt = &endTime
+		task.Result = result
 		log.Info("Completed task", slog.Int64("task_id", task.ID))
+	case errors.Is(cause, errTaskTimedOut):
+		task.State = model.TimedOutState
+		task.ProcessEndedAt = &endTime
+		task.Error, task.ErrorCode = errTaskTimedOut.Error(), model.TimeoutErrorCode
+		log.Info("Task timed out", slog.Int64("task_id", task.ID))
+	case task.Attempts < task.RetryPolicy.MaxAttempts:
+		policy := task.RetryPolicy
+		nextRunAt := endTime.Add(backoff.Exponential(policy.BaseDelay, policy.Multiplier, policy.Jitter, task.Attempts))
+		task.State = model.RetryingState
+		task.NextRunAt = &nextRunAt
+		task.Error, task.ErrorCode = err.Error(), errorCode(err)
+		log.Info(
+			"Failed to process task, retrying",
+			slog.Int64("task_id", task.ID),
+			slog.Int("attempt", task.Attempts),
+			slog.Time("next_run_at", nextRunAt),
+			slog.String("error", err.Error()),
+		)
+	default:
+		task.State = model.FailedState
+		task.ProcessEndedAt = &endTime
+		task.Error, task.ErrorCode = err.Error(), errorCode(err)
+		log.Info(
+			"Failed to process task",
+			slog.Int64("task_id", task.ID),
+			slog.Int("attempts", task.Attempts),
+			slog.String("error", err.Error()),
+		)
+	}
+	if err := s.saveAttempt(task, attempt); err != nil {
+		return
+	}
+	keepChildren = task.State == model.AwaitingChildrenState
+	s.events.Publish(task)
+	// Only finished tasks are counted: a retrying task is counted once its last attempt ends, a parent
+	// once its children complete it
+	switch {
+	case task.State.Finished():
+		s.webhooks.Notify(task)
+		s.resolveDependencies(context.Background())
+		metrics.TaskProcessed.WithLabelValues(string(task.State)).Inc()
+	case task.State == model.AwaitingChildrenState:
+		// Children may have finished before the parent was handled
+		s.resolveDependencies(context.Background())
+	}
+}
+
+// saveAttempt stores the outcome of attempt. If the attempt no longer holds the task, the outcome is dropped,
+// as the task was cancelled or recovered and someone else has already taken care of it
+func (s *TaskService) saveAttempt(task model.Task, attempt int) error {
+	const op = "service.saveAttempt"
+	log := s.log.With(slog.String("op", op))
+
+	err := s.store.SaveAttempt(context.Background(), task, attempt)
+	if errors.Is(err, store.ErrLeaseLost) {
+		log.Info("Dropped outcome of task which is no longer processed by the attempt",
+			slog.Int64("task_id", task.ID), slog.Int("attempt", attempt), slog.String("state", string(task.State)))
+		return err
 	}
-	task.ProcessEndedAt = &endTime
-	err = s.store.Update(context.Background(), task)
 	if err != nil {
 		log.Error(err.Error())
-		return
 	}
-	metrics.ActiveTasks.Dec()
-	metrics.TaskProcessed.WithLabelValues(string(task.State)).Inc()
+	return err
 }
@@ -2,31 +2,49 @@ package service_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"io-load-api/internal/broker"
+	"io-load-api/internal/config"
+	"io-load-api/internal/metrics"
 	"io-load-api/internal/model"
 	"io-load-api/internal/service"
+	"io-load-api/internal/store"
+	"io-load-api/internal/worker"
 	"log/slog"
 	"testing"
+	"time"
 )
 
 type MockStore struct {
 	mock.Mock
 }
 
-func (m *MockStore) Create(ctx context.Context) (model.Task, error) {
-	args := m.Called(ctx)
+func (m *MockStore) Create(ctx context.Context, task model.Task) (model.Task, error) {
+	args := m.Called(ctx, task)
 	return args.Get(0).(model.Task), args.Error(1)
 }
 
+func (m *MockStore) CreateBatch(ctx context.Context, tasks []model.Task) ([]model.Task, error) {
+	args := m.Called(ctx, tasks)
+	return args.Get(0).([]model.Task), args.Error(1)
+}
+
 func (m *MockStore) GetByID(ctx context.Context, taskID int64) (model.Task, error) {
 	args := m.Called(ctx, taskID)
 	return args.Get(0).(model.Task), args.Error(1)
 }
 
-func (m *MockStore) GetAll(ctx context.Context) ([]model.Task, error) {
-	args := m.Called(ctx)
+func (m *MockStore) GetByIdempotencyKey(ctx context.Context, key string) (model.Task, error) {
+	args := m.Called(ctx, key)
+	return args.Get(0).(model.Task), args.Error(1)
+}
+
+func (m *MockStore) GetAll(ctx context.Context, filter model.TaskFilter) ([]model.Task, error) {
+	args := m.Called(ctx, filter)
 	return args.Get(0).([]model.Task), args.Error(1)
 }
 
@@ -35,32 +53,196 @@ func (m *MockStore) Update(ctx context.Context, task model.Task) error {
 	return args.Error(0)
 }
 
+func (m *MockStore) SaveAttempt(ctx context.Context, task model.Task, attempt int) error {
+	args := m.Called(ctx, task, attempt)
+	return args.Error(0)
+}
+
+func (m *MockStore) Claim(ctx context.Context, lease time.Duration, types []string, aging time.Duration) (model.Task, error) {
+	args := m.Called(ctx, lease, types, aging)
+	return args.Get(0).(model.Task), args.Error(1)
+}
+
+func (m *MockStore) ExtendLease(ctx context.Context, taskID int64, attempt int, lease time.Duration) error {
+	args := m.Called(ctx, taskID, attempt, lease)
+	return args.Error(0)
+}
+
+func (m *MockStore) ReleaseExpired(ctx context.Context, now time.Time, state model.TaskState) ([]model.Task, error) {
+	args := m.Called(ctx, now, state)
+	return args.Get(0).([]model.Task), args.Error(1)
+}
+
+func (m *MockStore) CountByState(ctx context.Context, state model.TaskState) (int, error) {
+	args := m.Called(ctx, state)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStore) Cancel(ctx context.Context, taskID int64, now time.Time) (model.Task, error) {
+	args := m.Called(ctx, taskID, now)
+	return args.Get(0).(model.Task), args.Error(1)
+}
+
+func (m *MockStore) PromoteDue(ctx context.Context, now time.Time) ([]model.Task, error) {
+	args := m.Called(ctx, now)
+	return args.Get(0).([]model.Task), args.Error(1)
+}
+
+func (m *MockStore) CreateWorkflow(ctx context.Context, tasks []model.Task, dependencies [][]int) ([]model.Task, error) {
+	args := m.Called(ctx, tasks, dependencies)
+	return args.Get(0).([]model.Task), args.Error(1)
+}
+
+func (m *MockStore) ResolveDependencies(ctx context.Context, now time.Time) ([]model.Task, error) {
+	args := m.Called(ctx, now)
+	return args.Get(0).([]model.Task), args.Error(1)
+}
+
+func (m *MockStore) CompleteParents(ctx context.Context, now time.Time) ([]model.Task, error) {
+	args := m.Called(ctx, now)
+	return args.Get(0).([]model.Task), args.Error(1)
+}
+
+// newStore returns a store mock in which no task waits for dependencies or children
+func newStore() *MockStore {
+	store := new(MockStore)
+	store.On("ResolveDependencies", mock.Anything, mock.Anything).Return([]model.Task(nil), nil).Maybe()
+	store.On("CompleteParents", mock.Anything, mock.Anything).Return([]model.Task(nil), nil).Maybe()
+	store.On("GetAll", mock.Anything, mock.MatchedBy(func(filter model.TaskFilter) bool {
+		return filter.ParentID != nil
+	})).Return([]model.Task(nil), nil).Maybe()
+	return store
+}
+
+type MockPool struct {
+	mock.Mock
+}
+
+func (m *MockPool) Start(claim worker.ClaimFunc, handler worker.Handler) {
+	m.Called(claim, handler)
+}
+
+func (m *MockPool) Notify() {
+	m.Called()
+}
+
+func (m *MockPool) Stop(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+type MockNotifier struct {
+	mock.Mock
+}
+
+func (m *MockNotifier) Notify(task model.Task) {
+	m.Called(task)
+}
+
+// newNotifier accepts any webhook
+func newNotifier() *MockNotifier {
+	notifier := new(MockNotifier)
+	notifier.On("Notify", mock.Anything).Return().Maybe()
+	return notifier
+}
+
+var cfg = &config.Config{
+	WorkerPool: config.WorkerPool{QueueCapacity: 10},
+	Recovery: config.Recovery{
+		LeaseDuration:     30 * time.Second,
+		HeartbeatInterval: 10 * time.Second,
+		ReapInterval:      time.Hour,
+		Policy:            service.RequeuePolicy,
+	},
+	Scheduler: config.Scheduler{AgingInterval: time.Minute, PromoteInterval: time.Hour, CronInterval: time.Hour},
+	Retry:     config.Retry{MaxAttempts: 3, BaseDelay: time.Second, Multiplier: 2, Jitter: 0.2},
+}
+
+// newRegistry registers a handler for default task type which runs until its context is done
+func newRegistry() *service.Registry {
+	registry := service.NewRegistry()
+	_ = registry.Register(service.SimulateIOTaskType, service.TaskHandlerFunc(
+		func(ctx context.Context, _ model.Task) (json.RawMessage, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	))
+	return registry
+}
+
 func TestGetAllTasks(t *testing.T) {
-	mockStore := new(MockStore)
+	mockStore := newStore()
 	logger := slog.Default()
 
-	s := service.NewTaskService(logger, mockStore)
+	s := service.NewTaskService(logger, mockStore, new(MockPool), newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
 
 	tasks := []model.Task{
 		{ID: 1, State: model.CompletedState},
 		{ID: 2, State: model.ProcessingState},
 	}
 
-	mockStore.On("GetAll", mock.Anything).Return(tasks, nil)
+	mockStore.On("GetAll", mock.Anything, model.TaskFilter{Limit: 51}).Return(tasks, nil)
+
+	result, err := s.GetAllTasks(context.Background(), model.TaskQuery{})
+
+	assert.NoError(t, err)
+	assert.Len(t, result.Tasks, 2)
+	assert.Equal(t, tasks, result.Tasks)
+	assert.Empty(t, result.NextCursor)
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetAllTasks_NextPage(t *testing.T) {
+	mockStore := newStore()
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, new(MockPool), newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+
+	states := []model.TaskState{model.FailedState}
+	mockStore.On("GetAll", mock.Anything, model.TaskFilter{States: states, Descending: true, Limit: 3}).
+		Return([]model.Task{{ID: 9}, {ID: 7}, {ID: 4}}, nil).Once()
 
-	result, err := s.GetAllTasks(context.Background())
+	first, err := s.GetAllTasks(context.Background(), model.TaskQuery{States: states, Descending: true, Limit: 2})
 
 	assert.NoError(t, err)
-	assert.Len(t, result, 2)
-	assert.Equal(t, tasks, result)
+	assert.Equal(t, []model.Task{{ID: 9}, {ID: 7}}, first.Tasks)
+	assert.NotEmpty(t, first.NextCursor)
+
+	mockStore.On("GetAll", mock.Anything, model.TaskFilter{States: states, Descending: true, AfterID: 7, Limit: 3}).
+		Return([]model.Task{{ID: 4}}, nil).Once()
+
+	second, err := s.GetAllTasks(context.Background(), model.TaskQuery{
+		States:     states,
+		Descending: true,
+		Limit:      2,
+		Cursor:     first.NextCursor,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Task{{ID: 4}}, second.Tasks)
+	assert.Empty(t, second.NextCursor)
 	mockStore.AssertExpectations(t)
 }
 
+func TestGetAllTasks_InvalidQuery(t *testing.T) {
+	s := service.NewTaskService(slog.Default(), new(MockStore), new(MockPool), newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+
+	for _, query := range []model.TaskQuery{
+		{Limit: -1},
+		{Limit: 1001},
+		{Cursor: "not a cursor"},
+		{Cursor: "e30"},
+	} {
+		_, err := s.GetAllTasks(context.Background(), query)
+		assert.ErrorIs(t, err, service.ErrInvalidQuery, "query %+v", query)
+	}
+}
+
 func TestGetTaskByID_Success(t *testing.T) {
-	mockStore := new(MockStore)
+	mockStore := newStore()
 	logger := slog.Default()
 
-	s := service.NewTaskService(logger, mockStore)
+	s := service.NewTaskService(logger, mockStore, new(MockPool), newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
 
 	task := model.Task{ID: 1, State: model.CompletedState}
 
@@ -74,33 +256,842 @@ func TestGetTaskByID_Success(t *testing.T) {
 }
 
 func TestGetTaskByID_NotFound(t *testing.T) {
-	mockStore := new(MockStore)
+	mockStore := newStore()
 	logger := slog.Default()
 
-	s := service.NewTaskService(logger, mockStore)
+	s := service.NewTaskService(logger, mockStore, new(MockPool), newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
 
-	mockStore.On("GetByID", mock.Anything, int64(1)).Return(model.Task{}, errors.New("task not found"))
+	mockStore.On("GetByID", mock.Anything, int64(1)).Return(model.Task{}, store.ErrTaskNotFound)
 
 	result, err := s.GetTaskByID(context.Background(), 1)
 
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, service.ErrTaskNotFound)
 	assert.Equal(t, model.Task{}, result)
 	mockStore.AssertExpectations(t)
 }
 
+func TestGetTaskByID_StoreError(t *testing.T) {
+	mockStore := newStore()
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, new(MockPool), newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+
+	mockStore.On("GetByID", mock.Anything, int64(1)).Return(model.Task{}, errors.New("connection refused"))
+
+	_, err := s.GetTaskByID(context.Background(), 1)
+
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, service.ErrTaskNotFound)
+	mockStore.AssertExpectations(t)
+}
+
 func TestCreateTask(t *testing.T) {
-	mockStore := new(MockStore)
+	mockStore := newStore()
+	mockPool := new(MockPool)
 	logger := slog.Default()
 
-	s := service.NewTaskService(logger, mockStore)
+	s := service.NewTaskService(logger, mockStore, mockPool, newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
 
-	task := model.Task{ID: 1, State: model.CompletedState}
+	defaultPolicy := model.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, Multiplier: 2, Jitter: 0.2}
+	task := model.Task{ID: 1, Type: service.SimulateIOTaskType, State: model.PendingState, RetryPolicy: defaultPolicy}
 
-	mockStore.On("Create", mock.Anything).Return(task, nil)
+	mockStore.On("CountByState", mock.Anything, model.PendingState).Return(0, nil)
+	mockStore.On("Create", mock.Anything, model.Task{Type: service.SimulateIOTaskType, RetryPolicy: defaultPolicy}).Return(task, nil)
+	mockPool.On("Notify").Return()
 
-	taskID, err := s.CreateTask(context.Background())
+	taskID, err := s.CreateTask(context.Background(), model.TaskSpec{})
 
 	assert.NoError(t, err)
 	assert.Equal(t, task.ID, taskID)
 	mockStore.AssertExpectations(t)
+	mockPool.AssertExpectations(t)
+}
+
+func TestCreateTask_Scheduled(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, mockPool, newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+
+	runAt := time.Now().Add(time.Hour)
+	mockStore.On("CountByState", mock.Anything, model.PendingState).Return(0, nil)
+	mockStore.On("Create", mock.Anything, mock.MatchedBy(func(task model.Task) bool {
+		return task.State == model.ScheduledState && task.RunAt != nil && task.RunAt.Equal(runAt)
+	})).Return(model.Task{ID: 1, State: model.ScheduledState, RunAt: &runAt}, nil)
+
+	taskID, err := s.CreateTask(context.Background(), model.TaskSpec{RunAt: &runAt})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), taskID)
+	mockStore.AssertExpectations(t)
+	mockPool.AssertNotCalled(t, "Notify")
+}
+
+func TestCreateTask_DueRunAtStartsRightAway(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, mockPool, newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+
+	runAt := time.Now().Add(-time.Minute)
+	mockStore.On("CountByState", mock.Anything, model.PendingState).Return(0, nil)
+	mockStore.On("Create", mock.Anything, mock.MatchedBy(func(task model.Task) bool {
+		return task.State == "" && task.RunAt == nil
+	})).Return(model.Task{ID: 1, State: model.PendingState}, nil)
+	mockPool.On("Notify").Return()
+
+	_, err := s.CreateTask(context.Background(), model.TaskSpec{RunAt: &runAt})
+
+	assert.NoError(t, err)
+	mockStore.AssertExpectations(t)
+	mockPool.AssertExpectations(t)
+}
+
+func TestStart_PromotesDueTasks(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	promoteCfg := *cfg
+	promoteCfg.Scheduler.PromoteInterval = 10 * time.Millisecond
+	events := broker.New(slog.Default())
+	s := service.NewTaskService(logger, mockStore, mockPool, newRegistry(), events, newNotifier(), &promoteCfg)
+
+	changes, unsubscribe := events.Subscribe(1)
+	defer unsubscribe()
+
+	promoted := model.Task{ID: 1, State: model.PendingState}
+	mockStore.On("ReleaseExpired", mock.Anything, mock.Anything, model.PendingState).Return([]model.Task(nil), nil)
+	mockStore.On("PromoteDue", mock.Anything, mock.Anything).Return([]model.Task{promoted}, nil).Once()
+	mockStore.On("PromoteDue", mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockPool.On("Start", mock.Anything, mock.Anything).Return()
+	mockPool.On("Notify").Return().Once()
+	mockPool.On("Stop", mock.Anything).Return(nil)
+
+	s.Start()
+	select {
+	case task := <-changes:
+		assert.Equal(t, promoted, task)
+	case <-time.After(time.Second):
+		t.Fatal("promoted task was not published")
+	}
+	assert.NoError(t, s.Stop(context.Background()))
+
+	mockStore.AssertExpectations(t)
+	mockPool.AssertExpectations(t)
+}
+
+func TestCreateTask_QueueFull(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, mockPool, newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+
+	mockStore.On("CountByState", mock.Anything, model.PendingState).Return(10, nil)
+
+	_, err := s.CreateTask(context.Background(), model.TaskSpec{})
+
+	assert.ErrorIs(t, err, service.ErrQueueFull)
+	mockStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	mockPool.AssertNotCalled(t, "Notify")
+}
+
+func TestCreateTask_IdempotencyKey(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, mockPool, newRegistry(), broker.New(logger), newNotifier(), cfg)
+
+	spec := model.TaskSpec{Payload: json.RawMessage(`{"url":"http://example.com"}`), IdempotencyKey: "key-1"}
+
+	// The first request creates the task
+	var created model.Task
+	mockStore.On("GetByIdempotencyKey", mock.Anything, "key-1").Return(model.Task{}, store.ErrTaskNotFound).Once()
+	mockStore.On("CountByState", mock.Anything, model.PendingState).Return(0, nil)
+	mockStore.On("Create", mock.Anything, mock.MatchedBy(func(task model.Task) bool {
+		return task.IdempotencyKey == "key-1" && task.RequestHash != ""
+	})).Run(func(args mock.Arguments) {
+		created = args.Get(1).(model.Task)
+		created.ID = 7
+	}).Return(model.Task{ID: 7}, nil).Once()
+	mockPool.On("Notify").Return().Once()
+
+	taskID, err := s.CreateTask(context.Background(), spec)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), taskID)
+
+	// The retried request gets the same task
+	mockStore.On("GetByIdempotencyKey", mock.Anything, "key-1").Return(created, nil)
+
+	taskID, err = s.CreateTask(context.Background(), spec)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), taskID)
+
+	// Another request with the same key is rejected
+	spec.Payload = json.RawMessage(`{"url":"http://example.org"}`)
+	_, err = s.CreateTask(context.Background(), spec)
+	assert.ErrorIs(t, err, service.ErrIdempotencyConflict)
+
+	mockStore.AssertNumberOfCalls(t, "Create", 1)
+	mockPool.AssertExpectations(t)
+}
+
+func TestCreateTask_ConcurrentIdempotencyKey(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, mockPool, newRegistry(), broker.New(logger), newNotifier(), cfg)
+
+	// Another request with the same key has created the task between the lookup and the insert
+	mockStore.On("GetByIdempotencyKey", mock.Anything, "key-1").Return(model.Task{}, store.ErrTaskNotFound)
+	mockStore.On("CountByState", mock.Anything, model.PendingState).Return(0, nil)
+	existing := model.Task{ID: 3, IdempotencyKey: "key-1", RequestHash: "other request"}
+	mockStore.On("Create", mock.Anything, mock.Anything).Return(existing, store.ErrDuplicateKey)
+
+	_, err := s.CreateTask(context.Background(), model.TaskSpec{IdempotencyKey: "key-1"})
+
+	assert.ErrorIs(t, err, service.ErrIdempotencyConflict)
+	mockPool.AssertNotCalled(t, "Notify")
+}
+
+func TestCreateTasks(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	events := broker.New(logger)
+	s := service.NewTaskService(logger, mockStore, mockPool, newRegistry(), events, newNotifier(), cfg)
+	changes, unsubscribe := events.Subscribe(broker.AllTasks)
+	defer unsubscribe()
+
+	defaultPolicy := model.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, Multiplier: 2, Jitter: 0.2}
+	specs := []model.TaskSpec{{}, {Timeout: time.Minute}}
+	expected := []model.Task{
+		{Type: service.SimulateIOTaskType, RetryPolicy: defaultPolicy},
+		{Type: service.SimulateIOTaskType, RetryPolicy: defaultPolicy, Timeout: time.Minute},
+	}
+	createdAt := time.Now()
+	stored := []model.Task{
+		{ID: 4, Type: service.SimulateIOTaskType, State: model.PendingState, CreatedAt: createdAt},
+		{ID: 5, Type: service.SimulateIOTaskType, State: model.PendingState, CreatedAt: createdAt},
+	}
+
+	mockStore.On("CountByState", mock.Anything, model.PendingState).Return(0, nil)
+	mockStore.On("CreateBatch", mock.Anything, expected).Return(stored, nil)
+	mockPool.On("Notify").Return()
+
+	ids, err := s.CreateTasks(context.Background(), specs)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{4, 5}, ids)
+	// Subscribers get the stored tasks
+	assert.Equal(t, stored[0], <-changes)
+	assert.Equal(t, stored[1], <-changes)
+	mockStore.AssertExpectations(t)
+	mockPool.AssertExpectations(t)
+}
+
+func TestCreateTasks_Invalid(t *testing.T) {
+	mockStore := newStore()
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, new(MockPool), newRegistry(), broker.New(logger), newNotifier(), cfg)
+
+	_, err := s.CreateTasks(context.Background(), nil)
+	assert.ErrorIs(t, err, service.ErrInvalidTaskSpec)
+
+	// Nothing is created if any spec is invalid
+	_, err = s.CreateTasks(context.Background(), []model.TaskSpec{{}, {Timeout: -time.Second}})
+	assert.ErrorIs(t, err, service.ErrInvalidTaskSpec)
+	assert.ErrorContains(t, err, "task 1")
+
+	mockStore.AssertNotCalled(t, "CreateBatch", mock.Anything, mock.Anything)
+}
+
+func TestCreateTask_CustomRetryPolicy(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, mockPool, newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+
+	// Omitted options are taken from config
+	spec := model.TaskSpec{RetryPolicy: &model.RetryPolicy{MaxAttempts: 5, Jitter: 0}}
+	expected := model.RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, Multiplier: 2, Jitter: 0}
+
+	mockStore.On("CountByState", mock.Anything, model.PendingState).Return(0, nil)
+	mockStore.On("Create", mock.Anything, model.Task{Type: service.SimulateIOTaskType, RetryPolicy: expected}).Return(model.Task{ID: 1}, nil)
+	mockPool.On("Notify").Return()
+
+	_, err := s.CreateTask(context.Background(), spec)
+
+	assert.NoError(t, err)
+	mockStore.AssertExpectations(t)
+}
+
+func TestCreateTask_InvalidSpec(t *testing.T) {
+	mockStore := newStore()
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, new(MockPool), newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Minute)
+	specs := []model.TaskSpec{
+		{RetryPolicy: &model.RetryPolicy{MaxAttempts: -1}},
+		{RetryPolicy: &model.RetryPolicy{Multiplier: 0.5}},
+		{RetryPolicy: &model.RetryPolicy{Jitter: 2}},
+		{Timeout: -time.Second},
+		{Deadline: &past},
+		{Type: "unknown"},
+		{CallbackURL: "ftp://example.com/hook"},
+		{CallbackURL: "/hook"},
+		{CallbackURL: "http://169.254.169.254/latest/meta-data"},
+		{CallbackURL: "http://localhost:8080/hook"},
+		{Priority: model.MaxPriority + 1},
+		{Delay: -time.Second},
+		{Delay: time.Minute, RunAt: &future},
+		{Delay: time.Hour, Deadline: &future},
+	}
+	for _, spec := range specs {
+		_, err := s.CreateTask(context.Background(), spec)
+		assert.ErrorIs(t, err, service.ErrInvalidTaskSpec)
+	}
+	mockStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestStart_RequeuesExpiredTasks(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	events := broker.New(slog.Default())
+	s := service.NewTaskService(logger, mockStore, mockPool, newRegistry(), events, newNotifier(), cfg)
+
+	changes, unsubscribe := events.Subscribe(broker.AllTasks)
+	defer unsubscribe()
+
+	requeued := []model.Task{{ID: 1, State: model.PendingState}, {ID: 2, State: model.PendingState}}
+	mockStore.On("ReleaseExpired", mock.Anything, mock.Anything, model.PendingState).Return(requeued, nil)
+	mockPool.On("Notify").Return()
+	mockPool.On("Start", mock.Anything, mock.Anything).Return()
+	mockPool.On("Stop", mock.Anything).Return(nil)
+
+	s.Start()
+	assert.NoError(t, s.Stop(context.Background()))
+
+	assert.Equal(t, requeued[0], <-changes)
+	assert.Equal(t, requeued[1], <-changes)
+	mockStore.AssertExpectations(t)
+	mockPool.AssertExpectations(t)
+}
+
+func TestStart_FailsExpiredTasks(t *testing.T) {
+	mockStore := new(MockStore)
+	mockPool := new(MockPool)
+	notifier := new(MockNotifier)
+	logger := slog.Default()
+
+	failCfg := *cfg
+	failCfg.Recovery.Policy = service.FailPolicy
+	events := broker.New(slog.Default())
+	s := service.NewTaskService(logger, mockStore, mockPool, newRegistry(), events, notifier, &failCfg)
+
+	changes, unsubscribe := events.Subscribe(1)
+	defer unsubscribe()
+
+	failed := model.Task{ID: 1, State: model.FailedState, ErrorCode: model.LeaseExpiredErrorCode}
+	dependent := model.Task{ID: 2, State: model.FailedState, ErrorCode: model.DependencyFailedErrorCode}
+	mockStore.On("ReleaseExpired", mock.Anything, mock.Anything, model.FailedState).Return([]model.Task{failed}, nil)
+	// The task depending on the failed one fails in turn
+	mockStore.On("ResolveDependencies", mock.Anything, mock.Anything).Return([]model.Task{dependent}, nil).Once()
+	mockStore.On("ResolveDependencies", mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockStore.On("CompleteParents", mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	notifier.On("Notify", failed).Return().Once()
+	notifier.On("Notify", dependent).Return().Once()
+	mockPool.On("Start", mock.Anything, mock.Anything).Return()
+	mockPool.On("Stop", mock.Anything).Return(nil)
+
+	s.Start()
+	assert.NoError(t, s.Stop(context.Background()))
+
+	assert.Equal(t, failed, <-changes)
+	mockStore.AssertExpectations(t)
+	notifier.AssertExpectations(t)
+	mockPool.AssertNotCalled(t, "Notify")
+}
+
+func TestCancelTask(t *testing.T) {
+	mockStore := newStore()
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, new(MockPool), newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+
+	cancelled := model.Task{ID: 1, State: model.CancelledState}
+	mockStore.On("Cancel", mock.Anything, int64(1), mock.Anything).Return(cancelled, nil)
+
+	task, err := s.CancelTask(context.Background(), 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, cancelled, task)
+	mockStore.AssertExpectations(t)
+}
+
+func TestCancelTask_Errors(t *testing.T) {
+	cases := []struct {
+		storeErr error
+		expected error
+	}{
+		{store.ErrTaskNotFound, service.ErrTaskNotFound},
+		{store.ErrTaskFinished, service.ErrTaskFinished},
+	}
+	for _, tc := range cases {
+		mockStore := newStore()
+		logger := slog.Default()
+
+		s := service.NewTaskService(logger, mockStore, new(MockPool), newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+
+		mockStore.On("Cancel", mock.Anything, int64(1), mock.Anything).Return(model.Task{}, tc.storeErr)
+
+		_, err := s.CancelTask(context.Background(), 1)
+
+		assert.ErrorIs(t, err, tc.expected)
+	}
+}
+
+func TestCancelTask_StopsRunningTask(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, mockPool, newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+
+	var handler worker.Handler
+	mockStore.On("ReleaseExpired", mock.Anything, mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockPool.On("Start", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		handler = args.Get(1).(worker.Handler)
+	}).Return()
+	mockPool.On("Stop", mock.Anything).Return(nil)
+	s.Start()
+	defer s.Stop(context.Background())
+
+	task := model.Task{
+		ID:          1,
+		Type:        service.SimulateIOTaskType,
+		State:       model.ProcessingState,
+		Attempts:    1,
+		RetryPolicy: model.RetryPolicy{MaxAttempts: 3},
+	}
+	done := make(chan struct{})
+	go func() {
+		handler(context.Background(), task)
+		close(done)
+	}()
+
+	cancelled := task
+	cancelled.State = model.CancelledState
+	mockStore.On("Cancel", mock.Anything, int64(1), mock.Anything).Return(cancelled, nil)
+
+	// Wait until the task is registered as running
+	assert.Eventually(t, func() bool {
+		_, err := s.CancelTask(context.Background(), 1)
+		if err != nil {
+			return false
+		}
+		select {
+		case <-done:
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Cancelled task must not be overwritten with a failed or retrying state
+	mockStore.AssertNotCalled(t, "SaveAttempt", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestProcessTask_StopsWhenLeaseLost(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	registry := service.NewRegistry()
+	stopped := make(chan error, 1)
+	_ = registry.Register("fetch_url", service.TaskHandlerFunc(func(ctx context.Context, _ model.Task) (json.RawMessage, error) {
+		<-ctx.Done()
+		stopped <- context.Cause(ctx)
+		return nil, ctx.Err()
+	}))
+	heartbeatCfg := *cfg
+	heartbeatCfg.Recovery.HeartbeatInterval = 10 * time.Millisecond
+	s := service.NewTaskService(logger, mockStore, mockPool, registry, broker.New(slog.Default()), newNotifier(), &heartbeatCfg)
+
+	var handler worker.Handler
+	mockStore.On("ReleaseExpired", mock.Anything, mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockPool.On("Start", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		handler = args.Get(1).(worker.Handler)
+	}).Return()
+	mockPool.On("Stop", mock.Anything).Return(nil)
+	s.Start()
+	defer s.Stop(context.Background())
+
+	// The lease of the second attempt expired and the task was claimed again by another worker
+	mockStore.On("ExtendLease", mock.Anything, int64(1), 2, cfg.Recovery.LeaseDuration).Return(store.ErrLeaseLost)
+
+	handler(context.Background(), model.Task{ID: 1, Type: "fetch_url", State: model.ProcessingState, Attempts: 2})
+
+	assert.Error(t, <-stopped)
+	mockStore.AssertNotCalled(t, "SaveAttempt", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestProcessTask_DropsOutcomeOfCancelledTask(t *testing.T) {
+	mockStore := new(MockStore)
+	mockPool := new(MockPool)
+	notifier := new(MockNotifier)
+	logger := slog.Default()
+
+	registry := service.NewRegistry()
+	_ = registry.Register("fetch_url", service.TaskHandlerFunc(func(context.Context, model.Task) (json.RawMessage, error) {
+		return json.RawMessage(`{"status": 200}`), nil
+	}))
+	events := broker.New(logger)
+	s := service.NewTaskService(logger, mockStore, mockPool, registry, events, notifier, cfg)
+
+	var handler worker.Handler
+	mockStore.On("ReleaseExpired", mock.Anything, mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockPool.On("Start", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		handler = args.Get(1).(worker.Handler)
+	}).Return()
+	mockPool.On("Stop", mock.Anything).Return(nil)
+	s.Start()
+	defer s.Stop(context.Background())
+
+	changes, unsubscribe := events.Subscribe(1)
+	defer unsubscribe()
+
+	// The task was cancelled after the handler returned but before its outcome was stored
+	mockStore.On("SaveAttempt", mock.Anything, mock.MatchedBy(func(task model.Task) bool {
+		return task.State == model.CompletedState
+	}), 1).Return(store.ErrLeaseLost)
+
+	handler(context.Background(), model.Task{ID: 1, Type: "fetch_url", State: model.ProcessingState, Attempts: 1})
+
+	select {
+	case task := <-changes:
+		t.Fatalf("outcome of a cancelled task was published: %+v", task)
+	default:
+	}
+	mockStore.AssertExpectations(t)
+	mockStore.AssertNotCalled(t, "ResolveDependencies", mock.Anything, mock.Anything)
+	notifier.AssertNotCalled(t, "Notify", mock.Anything)
+}
+
+func TestProcessTask_TimesOut(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, mockPool, newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+
+	var handler worker.Handler
+	mockStore.On("ReleaseExpired", mock.Anything, mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockPool.On("Start", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		handler = args.Get(1).(worker.Handler)
+	}).Return()
+	mockPool.On("Stop", mock.Anything).Return(nil)
+	s.Start()
+	defer s.Stop(context.Background())
+
+	// Timed out task is not retried even if it has attempts left
+	task := model.Task{
+		ID:          1,
+		Type:        service.SimulateIOTaskType,
+		State:       model.ProcessingState,
+		Attempts:    1,
+		RetryPolicy: model.RetryPolicy{MaxAttempts: 3},
+		Timeout:     10 * time.Millisecond,
+	}
+	mockStore.On("SaveAttempt", mock.Anything, mock.MatchedBy(func(task model.Task) bool {
+		return task.ID == 1 && task.State == model.TimedOutState && task.ProcessEndedAt != nil &&
+			task.ErrorCode == model.TimeoutErrorCode
+	}), mock.Anything).Return(nil)
+
+	handler(context.Background(), task)
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestProcessTask_DispatchesByType(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	registry := service.NewRegistry()
+	handled := make(chan model.Task, 1)
+	_ = registry.Register("fetch_url", service.TaskHandlerFunc(func(_ context.Context, task model.Task) (json.RawMessage, error) {
+		handled <- task
+		return json.RawMessage(`{"status": 200}`), nil
+	}))
+	s := service.NewTaskService(logger, mockStore, mockPool, registry, broker.New(slog.Default()), newNotifier(), cfg)
+
+	var (
+		claim   worker.ClaimFunc
+		handler worker.Handler
+	)
+	mockStore.On("ReleaseExpired", mock.Anything, mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockPool.On("Start", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		claim = args.Get(0).(worker.ClaimFunc)
+		handler = args.Get(1).(worker.Handler)
+	}).Return()
+	mockPool.On("Stop", mock.Anything).Return(nil)
+	s.Start()
+	defer s.Stop(context.Background())
+
+	// Only registered types are claimed
+	task := model.Task{
+		ID:       1,
+		Type:     "fetch_url",
+		State:    model.ProcessingState,
+		Attempts: 1,
+		Payload:  json.RawMessage(`{"url": "http://example.com"}`),
+	}
+	mockStore.On("Claim", mock.Anything, cfg.Recovery.LeaseDuration, []string{"fetch_url"}, cfg.Scheduler.AgingInterval).
+		Return(task, nil)
+	mockStore.On("SaveAttempt", mock.Anything, mock.MatchedBy(func(task model.Task) bool {
+		return task.ID == 1 && task.State == model.CompletedState && string(task.Result) == `{"status": 200}`
+	}), mock.Anything).Return(nil)
+
+	claimed, err := claim(context.Background())
+	assert.NoError(t, err)
+	handler(context.Background(), claimed)
+
+	assert.Equal(t, task, <-handled)
+	mockStore.AssertExpectations(t)
+}
+
+func TestProcessTask_PublishesStateChanges(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	registry := service.NewRegistry()
+	_ = registry.Register("fetch_url", service.TaskHandlerFunc(func(context.Context, model.Task) (json.RawMessage, error) {
+		return nil, nil
+	}))
+	events := broker.New(logger)
+	s := service.NewTaskService(logger, mockStore, mockPool, registry, events, newNotifier(), cfg)
+
+	var (
+		claim   worker.ClaimFunc
+		handler worker.Handler
+	)
+	mockStore.On("ReleaseExpired", mock.Anything, mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockPool.On("Start", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		claim = args.Get(0).(worker.ClaimFunc)
+		handler = args.Get(1).(worker.Handler)
+	}).Return()
+	mockPool.On("Stop", mock.Anything).Return(nil)
+	s.Start()
+	defer s.Stop(context.Background())
+
+	changes, unsubscribe := events.Subscribe(1)
+	defer unsubscribe()
+
+	task := model.Task{ID: 1, Type: "fetch_url", State: model.ProcessingState, Attempts: 1}
+	mockStore.On("Claim", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(task, nil)
+	mockStore.On("SaveAttempt", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	claimed, err := claim(context.Background())
+	assert.NoError(t, err)
+	handler(context.Background(), claimed)
+
+	assert.Equal(t, model.ProcessingState, (<-changes).State)
+	assert.Equal(t, model.CompletedState, (<-changes).State)
+	mockStore.AssertExpectations(t)
+}
+
+func TestProcessTask_NotifiesWebhookOnFinish(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	notifier := new(MockNotifier)
+	logger := slog.Default()
+
+	registry := service.NewRegistry()
+	_ = registry.Register("fetch_url", service.TaskHandlerFunc(func(context.Context, model.Task) (json.RawMessage, error) {
+		return nil, errors.New("connection reset")
+	}))
+	s := service.NewTaskService(logger, mockStore, mockPool, registry, broker.New(logger), notifier, cfg)
+
+	var handler worker.Handler
+	mockStore.On("ReleaseExpired", mock.Anything, mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockPool.On("Start", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		handler = args.Get(1).(worker.Handler)
+	}).Return()
+	mockPool.On("Stop", mock.Anything).Return(nil)
+	s.Start()
+	defer s.Stop(context.Background())
+
+	mockStore.On("SaveAttempt", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	notifier.On("Notify", mock.MatchedBy(func(task model.Task) bool {
+		return task.ID == 2 && task.State == model.FailedState
+	})).Return().Once()
+
+	// A retried task is not finished yet, so only the last attempt is notified
+	policy := model.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Second, Multiplier: 1}
+	handler(context.Background(), model.Task{ID: 1, Type: "fetch_url", Attempts: 1, RetryPolicy: policy})
+	handler(context.Background(), model.Task{ID: 2, Type: "fetch_url", Attempts: 2, RetryPolicy: policy})
+
+	notifier.AssertExpectations(t)
+	notifier.AssertNumberOfCalls(t, "Notify", 1)
+}
+
+func TestProcessTask_StoresFailureReason(t *testing.T) {
+	cases := []struct {
+		err      error
+		attempts int
+		state    model.TaskState
+		code     string
+	}{
+		{errors.New("connection reset"), 1, model.RetryingState, model.HandlerErrorCode},
+		{errors.New("connection reset"), 3, model.FailedState, model.HandlerErrorCode},
+		{service.NewTaskError("NOT_FOUND", errors.New("url returned 404")), 3, model.FailedState, "NOT_FOUND"},
+	}
+	for _, tc := range cases {
+		mockStore := newStore()
+		mockPool := new(MockPool)
+		logger := slog.Default()
+
+		registry := service.NewRegistry()
+		_ = registry.Register("fetch_url", service.TaskHandlerFunc(func(context.Context, model.Task) (json.RawMessage, error) {
+			return nil, tc.err
+		}))
+		s := service.NewTaskService(logger, mockStore, mockPool, registry, broker.New(slog.Default()), newNotifier(), cfg)
+
+		var handler worker.Handler
+		mockStore.On("ReleaseExpired", mock.Anything, mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+		mockPool.On("Start", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			handler = args.Get(1).(worker.Handler)
+		}).Return()
+		mockPool.On("Stop", mock.Anything).Return(nil)
+		s.Start()
+
+		task := model.Task{
+			ID:          1,
+			Type:        "fetch_url",
+			State:       model.ProcessingState,
+			Attempts:    tc.attempts,
+			RetryPolicy: model.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, Multiplier: 2},
+		}
+		mockStore.On("SaveAttempt", mock.Anything, mock.MatchedBy(func(task model.Task) bool {
+			return task.State == tc.state && task.Error == tc.err.Error() && task.ErrorCode == tc.code
+		}), mock.Anything).Return(nil)
+		processed := testutil.ToFloat64(metrics.TaskProcessed.WithLabelValues(string(tc.state)))
+
+		handler(context.Background(), task)
+
+		mockStore.AssertExpectations(t)
+		// Attempts which will be retried are not processed tasks
+		if tc.state == model.RetryingState {
+			assert.Equal(t, processed, testutil.ToFloat64(metrics.TaskProcessed.WithLabelValues(string(tc.state))))
+		} else {
+			assert.Equal(t, processed+1, testutil.ToFloat64(metrics.TaskProcessed.WithLabelValues(string(tc.state))))
+		}
+		assert.NoError(t, s.Stop(context.Background()))
+	}
+}
+
+func TestStop_RejectsNewTasks(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, mockPool, newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+
+	mockPool.On("Stop", mock.Anything).Return(nil)
+	assert.NoError(t, s.Stop(context.Background()))
+
+	_, err := s.CreateTask(context.Background(), model.TaskSpec{})
+
+	assert.ErrorIs(t, err, service.ErrShuttingDown)
+	mockStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestProcessTask_RequeuesOnShutdown(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, mockPool, newRegistry(), broker.New(slog.Default()), newNotifier(), cfg)
+
+	var handler worker.Handler
+	mockStore.On("ReleaseExpired", mock.Anything, mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockPool.On("Start", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		handler = args.Get(1).(worker.Handler)
+	}).Return()
+	mockPool.On("Stop", mock.Anything).Return(nil)
+	s.Start()
+	defer s.Stop(context.Background())
+
+	startTime := time.Now()
+	task := model.Task{
+		ID:               1,
+		Type:             service.SimulateIOTaskType,
+		State:            model.ProcessingState,
+		Attempts:         2,
+		RetryPolicy:      model.RetryPolicy{MaxAttempts: 3},
+		ProcessStartedAt: &startTime,
+	}
+	mockStore.On("SaveAttempt", mock.Anything, mock.MatchedBy(func(task model.Task) bool {
+		return task.ID == 1 && task.State == model.PendingState && task.Attempts == 1 && task.ProcessStartedAt == nil
+	}), mock.Anything).Return(nil)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(worker.ErrShutdown)
+	handler(ctx, task)
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestProcessTask_KeepsOutcomeOfTaskSucceededOnShutdown(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	registry := service.NewRegistry()
+	_ = registry.Register("fetch_url", service.TaskHandlerFunc(func(context.Context, model.Task) (json.RawMessage, error) {
+		return json.RawMessage(`{"status": 200}`), nil
+	}))
+	s := service.NewTaskService(logger, mockStore, mockPool, registry, broker.New(slog.Default()), newNotifier(), cfg)
+
+	var handler worker.Handler
+	mockStore.On("ReleaseExpired", mock.Anything, mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockPool.On("Start", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		handler = args.Get(1).(worker.Handler)
+	}).Return()
+	mockPool.On("Stop", mock.Anything).Return(nil)
+	s.Start()
+	defer s.Stop(context.Background())
+
+	task := model.Task{
+		ID:          1,
+		Type:        "fetch_url",
+		State:       model.ProcessingState,
+		Attempts:    1,
+		RetryPolicy: model.RetryPolicy{MaxAttempts: 3},
+	}
+	mockStore.On("SaveAttempt", mock.Anything, mock.MatchedBy(func(task model.Task) bool {
+		return task.State == model.CompletedState && task.Attempts == 1 && string(task.Result) == `{"status": 200}`
+	}), 1).Return(nil)
+
+	// The handler completes its work although the shutdown deadline has just expired
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(worker.ErrShutdown)
+	handler(ctx, task)
+
+	mockStore.AssertExpectations(t)
 }
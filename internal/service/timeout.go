@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io-load-api/internal/model"
+	"time"
+)
+
+var errTaskTimedOut = errors.New("task timed out")
+
+// withTaskDeadline bounds ctx by the task deadline and by the attempt timeout counted from now,
+// whichever comes first. Expiration is reported through context.Cause as errTaskTimedOut
+func withTaskDeadline(ctx context.Context, task model.Task) (context.Context, context.CancelFunc) {
+	var deadline time.Time
+	if task.Deadline != nil {
+		deadline = *task.Deadline
+	}
+	if task.Timeout > 0 {
+		timeoutAt := time.Now().Add(task.Timeout)
+		if deadline.IsZero() || timeoutAt.Before(deadline) {
+			deadline = timeoutAt
+		}
+	}
+	if deadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadlineCause(ctx, deadline, errTaskTimedOut)
+}
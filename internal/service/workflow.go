@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io-load-api/internal/model"
+	"log/slog"
+)
+
+// CreateWorkflow creates tasks of a workflow at once and returns their IDs by node keys. A node starts once
+// the nodes it depends on have completed and fails if any of them does not. It returns ErrInvalidTaskSpec
+// if a node is invalid or dependencies form a cycle and ErrQueueFull if the queue is already full
+func (s *TaskService) CreateWorkflow(ctx context.Context, nodes []model.WorkflowNode) (map[string]int64, error) {
+	const op = "service.CreateWorkflow"
+	log := s.log.With(slog.String("op", op))
+
+	if s.draining.Load() {
+		return nil, fmt.Errorf("%s: %w", op, ErrShuttingDown)
+	}
+	if len(nodes) == 0 || len(nodes) > MaxBatchSize {
+		return nil, fmt.Errorf("%s: %w: workflow must contain from 1 to %d tasks", op, ErrInvalidTaskSpec, MaxBatchSize)
+	}
+
+	indexes := make(map[string]int, len(nodes))
+	for i, node := range nodes {
+		if node.Key == "" {
+			return nil, fmt.Errorf("%s: %w: task %d has no key", op, ErrInvalidTaskSpec, i)
+		}
+		if _, ok := indexes[node.Key]; ok {
+			return nil, fmt.Errorf("%s: %w: duplicate key %q", op, ErrInvalidTaskSpec, node.Key)
+		}
+		indexes[node.Key] = i
+	}
+
+	tasks := make([]model.Task, len(nodes))
+	dependencies := make([][]int, len(nodes))
+	var external []int64
+	for i, node := range nodes {
+		if node.Spec.IdempotencyKey != "" {
+			return nil, fmt.Errorf("%s: %w: %q: idempotency keys are not supported in workflows", op, ErrInvalidTaskSpec, node.Key)
+		}
+		task, err := s.newTask(node.Spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q: %w", op, node.Key, err)
+		}
+		for _, key := range node.DependsOn {
+			parent, ok := indexes[key]
+			if !ok {
+				return nil, fmt.Errorf("%s: %w: %q depends on unknown key %q", op, ErrInvalidTaskSpec, node.Key, key)
+			}
+			dependencies[i] = append(dependencies[i], parent)
+		}
+		if len(dependencies[i]) > 0 {
+			task.State = model.WaitingState
+		}
+		external = append(external, task.DependsOn...)
+		tasks[i] = task
+	}
+	if key, ok := findCycle(nodes, dependencies); ok {
+		return nil, fmt.Errorf("%s: %w: dependencies of %q form a cycle", op, ErrInvalidTaskSpec, key)
+	}
+	if err := s.checkDependencies(ctx, external); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pending, err := s.store.CountByState(ctx, model.PendingState)
+	if err != nil {
+		return nil, err
+	}
+	if pending >= s.queueCapacity {
+		log.Warn("Task queue is full", slog.Int("pending_tasks", pending))
+		return nil, fmt.Errorf("%s: %w", op, ErrQueueFull)
+	}
+
+	stored, err := s.store.CreateWorkflow(ctx, tasks, dependencies)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	log.Info("Created workflow", slog.Int("tasks_count", len(stored)))
+	created := make(map[string]int64, len(stored))
+	for i, task := range stored {
+		created[nodes[i].Key] = task.ID
+		s.events.Publish(task)
+		if startsRightAway(task) {
+			s.pool.Notify()
+		}
+	}
+	if len(external) > 0 {
+		s.resolveDependencies(ctx)
+	}
+	return created, nil
+}
+
+// findCycle returns the key of a node on a dependency cycle, if there is one
+func findCycle(nodes []model.WorkflowNode, dependencies [][]int) (string, bool) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := make([]int, len(nodes))
+
+	var visit func(i int) bool
+	visit = func(i int) bool {
+		states[i] = visiting
+		for _, parent := range dependencies[i] {
+			if states[parent] == visiting || states[parent] == unvisited && visit(parent) {
+				return true
+			}
+		}
+		states[i] = visited
+		return false
+	}
+	for i := range nodes {
+		if states[i] == unvisited && visit(i) {
+			return nodes[i].Key, true
+		}
+	}
+	return "", false
+}
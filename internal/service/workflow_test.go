@@ -0,0 +1,143 @@
+package service_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io-load-api/internal/broker"
+	"io-load-api/internal/model"
+	"io-load-api/internal/service"
+	"io-load-api/internal/store"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestCreateTask_WithDependencies(t *testing.T) {
+	mockStore := new(MockStore)
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, mockPool, newRegistry(), broker.New(logger), newNotifier(), cfg)
+
+	mockStore.On("CompleteParents", mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockStore.On("GetByID", mock.Anything, int64(1)).Return(model.Task{ID: 1, State: model.CompletedState}, nil)
+	mockStore.On("CountByState", mock.Anything, model.PendingState).Return(0, nil)
+	mockStore.On("Create", mock.Anything, mock.MatchedBy(func(task model.Task) bool {
+		return task.State == model.WaitingState && assert.ObjectsAreEqual([]int64{1}, task.DependsOn)
+	})).Return(model.Task{ID: 2, State: model.WaitingState, DependsOn: []int64{1}}, nil)
+	// The dependency has already completed, so the task is released right away
+	mockStore.On("ResolveDependencies", mock.Anything, mock.Anything).
+		Return([]model.Task{{ID: 2, State: model.PendingState}}, nil).Once()
+	mockPool.On("Notify").Return().Once()
+
+	taskID, err := s.CreateTask(context.Background(), model.TaskSpec{DependsOn: []int64{1, 1}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), taskID)
+	mockStore.AssertExpectations(t)
+	mockPool.AssertExpectations(t)
+}
+
+func TestCreateTask_UnknownDependency(t *testing.T) {
+	mockStore := newStore()
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, new(MockPool), newRegistry(), broker.New(logger), newNotifier(), cfg)
+
+	mockStore.On("GetByID", mock.Anything, int64(7)).Return(model.Task{}, store.ErrTaskNotFound)
+
+	for _, spec := range []model.TaskSpec{{DependsOn: []int64{7}}, {DependsOn: []int64{-1}}} {
+		_, err := s.CreateTask(context.Background(), spec)
+		assert.ErrorIs(t, err, service.ErrInvalidTaskSpec)
+	}
+	mockStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestCancelTask_FailsDependents(t *testing.T) {
+	mockStore := new(MockStore)
+	notifier := new(MockNotifier)
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, new(MockPool), newRegistry(), broker.New(logger), notifier, cfg)
+
+	child := model.Task{ID: 2, State: model.FailedState, ErrorCode: model.DependencyFailedErrorCode}
+	grandchild := model.Task{ID: 3, State: model.FailedState, ErrorCode: model.DependencyFailedErrorCode}
+	mockStore.On("Cancel", mock.Anything, int64(1), mock.Anything).Return(model.Task{ID: 1, State: model.CancelledState}, nil)
+	mockStore.On("GetAll", mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockStore.On("CompleteParents", mock.Anything, mock.Anything).Return([]model.Task(nil), nil)
+	mockStore.On("ResolveDependencies", mock.Anything, mock.Anything).Return([]model.Task{child}, nil).Once()
+	mockStore.On("ResolveDependencies", mock.Anything, mock.Anything).Return([]model.Task{grandchild}, nil).Once()
+	mockStore.On("ResolveDependencies", mock.Anything, mock.Anything).Return([]model.Task(nil), nil).Once()
+	notifier.On("Notify", child).Return().Once()
+	notifier.On("Notify", grandchild).Return().Once()
+
+	_, err := s.CancelTask(context.Background(), 1)
+
+	assert.NoError(t, err)
+	mockStore.AssertExpectations(t)
+	notifier.AssertExpectations(t)
+}
+
+func TestCreateWorkflow(t *testing.T) {
+	mockStore := newStore()
+	mockPool := new(MockPool)
+	logger := slog.Default()
+
+	events := broker.New(logger)
+	s := service.NewTaskService(logger, mockStore, mockPool, newRegistry(), events, newNotifier(), cfg)
+	changes, unsubscribe := events.Subscribe(broker.AllTasks)
+	defer unsubscribe()
+
+	nodes := []model.WorkflowNode{
+		{Key: "fetch"},
+		{Key: "parse", DependsOn: []string{"fetch"}},
+		{Key: "store", DependsOn: []string{"fetch", "parse"}, Spec: model.TaskSpec{Timeout: time.Minute}},
+	}
+	createdAt := time.Now()
+	stored := []model.Task{
+		{ID: 10, State: model.PendingState, CreatedAt: createdAt},
+		{ID: 11, State: model.WaitingState, CreatedAt: createdAt, DependsOn: []int64{10}},
+		{ID: 12, State: model.WaitingState, CreatedAt: createdAt, DependsOn: []int64{10, 11}},
+	}
+	mockStore.On("CountByState", mock.Anything, model.PendingState).Return(0, nil)
+	mockStore.On("CreateWorkflow", mock.Anything, mock.MatchedBy(func(tasks []model.Task) bool {
+		return len(tasks) == 3 && tasks[0].State == "" &&
+			tasks[1].State == model.WaitingState && tasks[2].State == model.WaitingState &&
+			tasks[2].Timeout == time.Minute
+	}), [][]int{nil, {0}, {0, 1}}).Return(stored, nil)
+	mockPool.On("Notify").Return().Once()
+
+	ids, err := s.CreateWorkflow(context.Background(), nodes)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"fetch": 10, "parse": 11, "store": 12}, ids)
+	// Subscribers get the stored tasks
+	for _, task := range stored {
+		assert.Equal(t, task, <-changes)
+	}
+	mockStore.AssertExpectations(t)
+	mockPool.AssertExpectations(t)
+}
+
+func TestCreateWorkflow_Invalid(t *testing.T) {
+	mockStore := newStore()
+	logger := slog.Default()
+
+	s := service.NewTaskService(logger, mockStore, new(MockPool), newRegistry(), broker.New(logger), newNotifier(), cfg)
+
+	workflows := [][]model.WorkflowNode{
+		nil,
+		{{Key: ""}},
+		{{Key: "a"}, {Key: "a"}},
+		{{Key: "a", DependsOn: []string{"b"}}},
+		{{Key: "a", DependsOn: []string{"a"}}},
+		{{Key: "a", DependsOn: []string{"c"}}, {Key: "b", DependsOn: []string{"a"}}, {Key: "c", DependsOn: []string{"b"}}},
+		{{Key: "a", Spec: model.TaskSpec{Type: "unknown"}}},
+	}
+	for _, nodes := range workflows {
+		_, err := s.CreateWorkflow(context.Background(), nodes)
+		assert.ErrorIs(t, err, service.ErrInvalidTaskSpec)
+	}
+	mockStore.AssertNotCalled(t, "CreateWorkflow", mock.Anything, mock.Anything, mock.Anything)
+}
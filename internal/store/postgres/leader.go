@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// schedulerLockKey is the advisory lock held by the instance which fires schedules
+const schedulerLockKey int64 = 0x7363686564756c65
+
+// Elector elects one leader among instances sharing the database by holding a session advisory lock.
+// The lock is released by Postgres as soon as the holding connection is closed, so when the leader crashes
+// another instance takes over after at most one check interval
+type Elector struct {
+	log      *slog.Logger
+	store    Store
+	interval time.Duration
+	leader   atomic.Bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewElector(log *slog.Logger, store Store, interval time.Duration) *Elector {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Elector{
+		log:      log,
+		store:    store,
+		interval: interval,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+}
+
+// IsLeader reports whether this instance currently holds the lock
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Start campaigns for leadership in background until Stop is called
+func (e *Elector) Start() {
+	go func() {
+		defer close(e.done)
+		e.run()
+	}()
+}
+
+// Stop gives up leadership and waits for the elector to return
+func (e *Elector) Stop() {
+	e.cancel()
+	<-e.done
+}
+
+func (e *Elector) run() {
+	const op = "postgres.Elector.run"
+	log := e.log.With(slog.String("op", op))
+
+	for {
+		err := e.campaign(e.ctx)
+		if e.leader.Swap(false) {
+			log.Info("Lost scheduler leadership")
+		}
+		if e.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Error("Leader election connection failed", slog.String("error", err.Error()))
+		}
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-time.After(e.interval):
+		}
+	}
+}
+
+// campaign tries to take the lock every interval and, once taken, checks the connection every interval.
+// It returns when the connection fails
+func (e *Elector) campaign(ctx context.Context) error {
+	conn, err := e.store.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The lock belongs to the session, so the connection is not returned to the pool
+	pgConn := conn.Hijack()
+	defer pgConn.Close(context.Background())
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		if e.leader.Load() {
+			if _, err := pgConn.Exec(ctx, "SELECT 1"); err != nil {
+				return err
+			}
+		} else {
+			var acquired bool
+			err := pgConn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", schedulerLockKey).Scan(&acquired)
+			if err != nil {
+				return err
+			}
+			if acquired {
+				e.leader.Store(true)
+				e.log.Info("Became scheduler leader")
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
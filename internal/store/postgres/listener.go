@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io-load-api/internal/model"
+	"log/slog"
+	"time"
+)
+
+// changesChannel is the notification channel task changes are sent to
+const changesChannel = "task_changes"
+
+// relistenDelay is how long the listener waits before reconnecting after the connection is lost
+const relistenDelay = time.Second
+
+// change is the payload of a task change notification
+type change struct {
+	ID     int64           `json:"id"`
+	State  model.TaskState `json:"state"`
+	Origin string          `json:"origin"`
+}
+
+// Publisher delivers task changes to local subscribers
+type Publisher interface {
+	Publish(task model.Task)
+	Subscribed(taskID int64) bool
+}
+
+// Listener receives notifications about tasks changed by other instances and publishes the changed tasks
+// to local subscribers. Changes made by this instance are published by the service itself
+type Listener struct {
+	log    *slog.Logger
+	store  *TaskStore
+	events Publisher
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewListener(log *slog.Logger, store *TaskStore, events Publisher) *Listener {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Listener{
+		log:    log,
+		store:  store,
+		events: events,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// Start listens for notifications in background until Stop is called
+func (l *Listener) Start() {
+	go func() {
+		defer close(l.done)
+		l.run()
+	}()
+}
+
+// Stop closes the listening connection and waits for the listener to return
+func (l *Listener) Stop() {
+	l.cancel()
+	<-l.done
+}
+
+func (l *Listener) run() {
+	const op = "postgres.Listener.run"
+	log := l.log.With(slog.String("op", op))
+
+	for {
+		err := l.listen(l.ctx)
+		if l.ctx.Err() != nil {
+			return
+		}
+		// Notifications sent while reconnecting are lost, waiters fall back to polling
+		log.Error("Lost task changes listener connection", slog.String("error", err.Error()))
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-time.After(relistenDelay):
+		}
+	}
+}
+
+func (l *Listener) listen(ctx context.Context) error {
+	conn, err := l.store.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection stays subscribed to the channel, so it is not returned to the pool
+	pgConn := conn.Hijack()
+	defer pgConn.Close(context.Background())
+
+	if _, err := pgConn.Exec(ctx, "LISTEN "+changesChannel); err != nil {
+		return err
+	}
+	for {
+		notification, err := pgConn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		l.handle(ctx, notification.Payload)
+	}
+}
+
+func (l *Listener) handle(ctx context.Context, payload string) {
+	const op = "postgres.Listener.handle"
+	log := l.log.With(slog.String("op", op))
+
+	var c change
+	if err := json.Unmarshal([]byte(payload), &c); err != nil {
+		log.Error(fmt.Sprintf("invalid notification payload %q: %s", payload, err))
+		return
+	}
+	if c.Origin == l.store.instanceID {
+		return
+	}
+	// Most changes interest nobody here, so the task is not fetched for them
+	if !l.events.Subscribed(c.ID) {
+		return
+	}
+	task, err := l.store.GetByID(ctx, c.ID)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	l.events.Publish(task)
+}
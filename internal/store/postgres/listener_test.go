@@ -0,0 +1,66 @@
+package postgres_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"io-load-api/internal/broker"
+	"io-load-api/internal/model"
+	"io-load-api/internal/store/postgres"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// TestListener_PublishesForeignChanges runs against the migrated database configured by the file
+// in TEST_CONFIG_PATH. Two stores stand for two instances sharing the database
+func TestListener_PublishesForeignChanges(t *testing.T) {
+	cfg := testConfig(t)
+	logger := slog.Default()
+	ctx := context.Background()
+
+	localDB, err := postgres.New(logger, &cfg)
+	require.NoError(t, err)
+	remoteDB, err := postgres.New(logger, &cfg)
+	require.NoError(t, err)
+	local, remote := postgres.NewTaskStore(localDB), postgres.NewTaskStore(remoteDB)
+
+	events := broker.New(logger)
+	changes, unsubscribe := events.Subscribe(broker.AllTasks)
+	defer unsubscribe()
+	listener := postgres.NewListener(logger, local, events)
+	listener.Start()
+	defer listener.Stop()
+
+	// Notifications sent before the listener subscribes to the channel are lost, so tasks are created
+	// until one of them is delivered
+	require.Eventually(t, func() bool {
+		if _, err := remote.Create(ctx, model.Task{Type: "remote"}); err != nil {
+			return false
+		}
+		select {
+		case <-changes:
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Changes made by this instance are published by the service, so the listener skips them. Notifications
+	// arrive in order, so the local one has been handled once the remote one is delivered
+	_, err = local.Create(ctx, model.Task{Type: "local"})
+	require.NoError(t, err)
+	created, err := remote.Create(ctx, model.Task{Type: "remote"})
+	require.NoError(t, err)
+
+	for {
+		select {
+		case task := <-changes:
+			require.NotEqual(t, "local", task.Type, "own change was published")
+			if task.ID == created.ID {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("remote change was not published")
+		}
+	}
+}
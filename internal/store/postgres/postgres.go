@@ -2,6 +2,8 @@ package postgres
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -12,6 +14,8 @@ import (
 
 type Store struct {
 	db *pgxpool.Pool
+	// instanceID marks change notifications sent by this instance, so its listener skips them
+	instanceID string
 }
 
 func New(log *slog.Logger, cfg *config.Config) (Store, error) {
@@ -45,10 +49,16 @@ func New(log *slog.Logger, cfg *config.Config) (Store, error) {
 		err := pool.Ping(pingCtx)
 		pingCancel()
 		if err == nil {
-			return Store{db: pool}, nil
+			return Store{db: pool, instanceID: newInstanceID()}, nil
 		}
 	}
 
 	pool.Close()
 	return Store{}, errors.New("failed to connect to postgres")
 }
+
+func newInstanceID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"io-load-api/internal/model"
+	"io-load-api/internal/store"
+	"time"
+)
+
+type ScheduleStore struct {
+	Store
+}
+
+func NewScheduleStore(store Store) *ScheduleStore {
+	return &ScheduleStore{store}
+}
+
+// scheduleColumns lists columns in the order expected by scanSchedule
+const scheduleColumns = `id, cron_expr, template, next_run_at, last_run_at, created_at`
+
+func scanSchedule(row pgx.Row) (model.Schedule, error) {
+	var (
+		schedule model.Schedule
+		template []byte
+	)
+	err := row.Scan(
+		&schedule.ID,
+		&schedule.Cron,
+		&template,
+		&schedule.NextRunAt,
+		&schedule.LastRunAt,
+		&schedule.CreatedAt,
+	)
+	if err != nil {
+		return model.Schedule{}, err
+	}
+	if err := json.Unmarshal(template, &schedule.Template); err != nil {
+		return model.Schedule{}, fmt.Errorf("invalid template of schedule %d: %s", schedule.ID, err)
+	}
+	return schedule, nil
+}
+
+// Create inserts schedule and returns it with the ID and the creation time
+func (s *ScheduleStore) Create(ctx context.Context, schedule model.Schedule) (model.Schedule, error) {
+	const op = "postgres.schedule.Create"
+
+	template, err := json.Marshal(schedule.Template)
+	if err != nil {
+		return model.Schedule{}, fmt.Errorf("%s: %s", op, err)
+	}
+	const query = `
+		INSERT INTO schedules (cron_expr, template, next_run_at, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + scheduleColumns
+	created, err := scanSchedule(s.db.QueryRow(ctx, query, schedule.Cron, template, schedule.NextRunAt, time.Now()))
+	if err != nil {
+		return model.Schedule{}, fmt.Errorf("%s: %s", op, err)
+	}
+	return created, nil
+}
+
+func (s *ScheduleStore) GetByID(ctx context.Context, scheduleID int64) (model.Schedule, error) {
+	const op = "postgres.schedule.GetByID"
+
+	const query = `SELECT ` + scheduleColumns + ` FROM schedules WHERE id = $1`
+	schedule, err := scanSchedule(s.db.QueryRow(ctx, query, scheduleID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Schedule{}, store.ErrScheduleNotFound
+	}
+	if err != nil {
+		return model.Schedule{}, fmt.Errorf("%s: %s", op, err)
+	}
+	return schedule, nil
+}
+
+// GetAll returns all schedules ordered by ID
+func (s *ScheduleStore) GetAll(ctx context.Context) ([]model.Schedule, error) {
+	const op = "postgres.schedule.GetAll"
+
+	return s.query(ctx, op, `SELECT `+scheduleColumns+` FROM schedules ORDER BY id`)
+}
+
+// GetDue returns schedules whose next activation is not after now
+func (s *ScheduleStore) GetDue(ctx context.Context, now time.Time) ([]model.Schedule, error) {
+	const op = "postgres.schedule.GetDue"
+
+	return s.query(ctx, op, `SELECT `+scheduleColumns+` FROM schedules WHERE next_run_at <= $1 ORDER BY id`, now)
+}
+
+func (s *ScheduleStore) query(ctx context.Context, op, query string, args ...any) ([]model.Schedule, error) {
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	defer rows.Close()
+
+	var schedules []model.Schedule
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+		schedules = append(schedules, schedule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	return schedules, nil
+}
+
+// Delete removes a schedule. Tasks it has already created are kept
+func (s *ScheduleStore) Delete(ctx context.Context, scheduleID int64) error {
+	const op = "postgres.schedule.Delete"
+
+	tag, err := s.db.Exec(ctx, `DELETE FROM schedules WHERE id = $1`, scheduleID)
+	if err != nil {
+		return fmt.Errorf("%s: %s", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return store.ErrScheduleNotFound
+	}
+	return nil
+}
+
+// Fire creates task for the activation schedule.NextRunAt and moves the schedule to its next activation in one
+// transaction. If the activation was already fired or the schedule was deleted, it returns store.ErrScheduleNotDue,
+// so an activation creates a single task even if several instances fire it
+func (s *ScheduleStore) Fire(
+	ctx context.Context,
+	schedule model.Schedule,
+	next time.Time,
+	task model.Task,
+) (model.Task, error) {
+	const op = "postgres.schedule.Fire"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	const advance = `
+		UPDATE schedules SET next_run_at = $1, last_run_at = $2
+		WHERE id = $3 AND next_run_at = $2
+	`
+	tag, err := tx.Exec(ctx, advance, next, schedule.NextRunAt, schedule.ID)
+	if err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return model.Task{}, store.ErrScheduleNotDue
+	}
+
+	created, err := s.insertTask(ctx, tx, task)
+	if err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	return created, nil
+}
@@ -2,9 +2,13 @@ package postgres
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v5"
 	"io-load-api/internal/model"
+	"io-load-api/internal/store"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -16,98 +20,768 @@ func NewTaskStore(store Store) *TaskStore {
 	return &TaskStore{store}
 }
 
-func (s *TaskStore) Create(ctx context.Context) (model.Task, error) {
+// taskColumns lists columns in the order expected by scanTask
+const taskColumns = `
+	id, type, state, created_at, process_started_at, process_ended_at, lease_expires_at,
+	attempts, max_attempts, retry_base_delay_ms, retry_multiplier, retry_jitter, next_run_at,
+	timeout_ms, deadline, payload, result, error_message, error_code, callback_url, idempotency_key, request_hash,
+	priority, run_at, parent_id
+`
+
+// notifyChange is a FROM item which sends a change notification for every row of the changed CTE.
+// It takes the placeholder number of the instance ID
+const notifyChange = `
+	pg_notify('` + changesChannel + `', json_build_object(
+		'id', changed.id, 'state', changed.state, 'origin', $%d::text
+	)::text)
+`
+
+func scanTask(row pgx.Row) (model.Task, error) {
+	var (
+		task           model.Task
+		baseDelayMs    int64
+		timeoutMs      int64
+		idempotencyKey *string
+	)
+	err := row.Scan(
+		&task.ID,
+		&task.Type,
+		&task.State,
+		&task.CreatedAt,
+		&task.ProcessStartedAt,
+		&task.ProcessEndedAt,
+		&task.LeaseExpiresAt,
+		&task.Attempts,
+		&task.RetryPolicy.MaxAttempts,
+		&baseDelayMs,
+		&task.RetryPolicy.Multiplier,
+		&task.RetryPolicy.Jitter,
+		&task.NextRunAt,
+		&timeoutMs,
+		&task.Deadline,
+		&task.Payload,
+		&task.Result,
+		&task.Error,
+		&task.ErrorCode,
+		&task.CallbackURL,
+		&idempotencyKey,
+		&task.RequestHash,
+		&task.Priority,
+		&task.RunAt,
+		&task.ParentID,
+	)
+	if idempotencyKey != nil {
+		task.IdempotencyKey = *idempotencyKey
+	}
+	task.RetryPolicy.BaseDelay = time.Duration(baseDelayMs) * time.Millisecond
+	task.Timeout = time.Duration(timeoutMs) * time.Millisecond
+	return task, err
+}
+
+// Create inserts a new pending, scheduled or waiting task with options taken from task.
+// If another task has the same idempotency key, it returns that task and store.ErrDuplicateKey
+func (s *TaskStore) Create(ctx context.Context, task model.Task) (model.Task, error) {
 	const op = "postgres.task.Create"
 
-	const query = `INSERT INTO tasks DEFAULT VALUES RETURNING id, created_at`
 	var (
-		id        int64
-		createdAt time.Time
+		created model.Task
+		err     error
 	)
+	if len(task.DependsOn) == 0 {
+		created, err = s.insertTask(ctx, s.db, task)
+	} else {
+		created, err = s.insertWaitingTask(ctx, task)
+	}
+	if errors.Is(err, pgx.ErrNoRows) && task.IdempotencyKey != "" {
+		existing, err := s.GetByIdempotencyKey(ctx, task.IdempotencyKey)
+		if err != nil {
+			return model.Task{}, fmt.Errorf("%s: %w", op, err)
+		}
+		return existing, store.ErrDuplicateKey
+	}
+	if err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	return created, nil
+}
+
+// insertWaitingTask inserts task and its dependencies in one transaction
+func (s *TaskStore) insertWaitingTask(ctx context.Context, task model.Task) (model.Task, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return model.Task{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	created, err := s.insertTask(ctx, tx, task)
+	if err != nil {
+		return model.Task{}, err
+	}
+	const query = `INSERT INTO task_dependencies (task_id, depends_on_id) SELECT $1, unnest($2::bigint[])`
+	if _, err := tx.Exec(ctx, query, created.ID, task.DependsOn); err != nil {
+		return model.Task{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return model.Task{}, err
+	}
+	created.DependsOn = task.DependsOn
+	return created, nil
+}
+
+// rowQuerier is implemented by both the pool and transactions
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// insertTask inserts task with q and sends a change notification.
+// It returns pgx.ErrNoRows if another task has the same idempotency key
+func (s Store) insertTask(ctx context.Context, q rowQuerier, task model.Task) (model.Task, error) {
+	query := `
+		WITH changed AS (
+			INSERT INTO tasks (
+				type, max_attempts, retry_base_delay_ms, retry_multiplier, retry_jitter, timeout_ms, deadline, payload,
+				callback_url, idempotency_key, request_hash, priority, state, run_at, parent_id
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11, $12, $13, $14, $15)
+			ON CONFLICT (idempotency_key) DO NOTHING
+			RETURNING ` + taskColumns + `
+		)
+		SELECT ` + taskColumns + ` FROM changed, ` + fmt.Sprintf(notifyChange, 16)
+	return scanTask(q.QueryRow(
+		ctx, query,
+		task.Type,
+		task.RetryPolicy.MaxAttempts,
+		task.RetryPolicy.BaseDelay.Milliseconds(),
+		task.RetryPolicy.Multiplier,
+		task.RetryPolicy.Jitter,
+		task.Timeout.Milliseconds(),
+		task.Deadline,
+		task.Payload,
+		task.CallbackURL,
+		task.IdempotencyKey,
+		task.RequestHash,
+		task.Priority,
+		store.InitialState(task),
+		task.RunAt,
+		task.ParentID,
+		s.instanceID,
+	))
+}
+
+// CreateBatch inserts tasks as new pending, scheduled or waiting tasks in one transaction and returns the stored
+// tasks in the order of tasks. IDs are taken from the sequence beforehand, so rows can be loaded with COPY
+func (s *TaskStore) CreateBatch(ctx context.Context, tasks []model.Task) ([]model.Task, error) {
+	return s.CreateWorkflow(ctx, tasks, nil)
+}
+
+// CreateWorkflow inserts tasks like CreateBatch. Task i also depends on tasks whose indexes are listed
+// in dependencies[i], in addition to its own DependsOn
+func (s *TaskStore) CreateWorkflow(ctx context.Context, tasks []model.Task, dependencies [][]int) ([]model.Task, error) {
+	const op = "postgres.task.CreateWorkflow"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(
+		ctx,
+		`SELECT nextval(pg_get_serial_sequence('tasks', 'id')) FROM generate_series(1, $1)`,
+		len(tasks),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+
+	// Dependencies within the workflow refer to the IDs taken above
+	tasks = slices.Clone(tasks)
+	var edges [][]any
+	for i := range tasks {
+		if i < len(dependencies) {
+			tasks[i].DependsOn = slices.Clone(tasks[i].DependsOn)
+			for _, parent := range dependencies[i] {
+				tasks[i].DependsOn = append(tasks[i].DependsOn, ids[parent])
+			}
+		}
+		for _, parentID := range tasks[i].DependsOn {
+			edges = append(edges, []any{ids[i], parentID})
+		}
+	}
+
+	columns := []string{
+		"id", "type", "max_attempts", "retry_base_delay_ms", "retry_multiplier", "retry_jitter", "timeout_ms",
+		"deadline", "payload", "callback_url", "priority", "state", "run_at", "parent_id",
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"tasks"}, columns, pgx.CopyFromSlice(len(tasks), func(i int) ([]any, error) {
+		task := tasks[i]
+		return []any{
+			ids[i],
+			task.Type,
+			task.RetryPolicy.MaxAttempts,
+			task.RetryPolicy.BaseDelay.Milliseconds(),
+			task.RetryPolicy.Multiplier,
+			task.RetryPolicy.Jitter,
+			task.Timeout.Milliseconds(),
+			task.Deadline,
+			task.Payload,
+			task.CallbackURL,
+			task.Priority,
+			store.InitialState(task),
+			task.RunAt,
+			task.ParentID,
+		}, nil
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+
+	if len(edges) > 0 {
+		_, err = tx.CopyFrom(
+			ctx, pgx.Identifier{"task_dependencies"}, []string{"task_id", "depends_on_id"}, pgx.CopyFromRows(edges),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+	}
+
+	// Rows are read back for the defaults filled in by the database. Notifications are sent on commit
+	query := `
+		WITH changed AS (
+			SELECT ` + taskColumns + ` FROM tasks WHERE id = ANY($1)
+		)
+		SELECT ` + taskColumns + ` FROM changed, ` + fmt.Sprintf(notifyChange, 2)
+	rows, err = tx.Query(ctx, query, ids, s.instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	stored, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Task, error) {
+		return scanTask(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	byID := make(map[int64]model.Task, len(stored))
+	for _, task := range stored {
+		byID[task.ID] = task
+	}
+	created := make([]model.Task, len(tasks))
+	for i, id := range ids {
+		created[i] = byID[id]
+		created[i].DependsOn = tasks[i].DependsOn
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	return created, nil
+}
+
+// GetByIdempotencyKey returns the task created with key or store.ErrTaskNotFound
+func (s *TaskStore) GetByIdempotencyKey(ctx context.Context, key string) (model.Task, error) {
+	const op = "postgres.task.GetByIdempotencyKey"
 
-	row := s.db.QueryRow(ctx, query)
-	err := row.Scan(&id, &createdAt)
+	const query = `SELECT ` + taskColumns + ` FROM tasks WHERE idempotency_key = $1`
+	task, err := scanTask(s.db.QueryRow(ctx, query, key))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Task{}, store.ErrTaskNotFound
+	}
 	if err != nil {
 		return model.Task{}, fmt.Errorf("%s: %s", op, err)
 	}
-	return model.Task{
-		ID:        id,
-		State:     model.PendingState,
-		CreatedAt: createdAt,
-	}, nil
+	return task, nil
 }
 
+// GetByID returns the task with taskId and the tasks it depends on or store.ErrTaskNotFound
 func (s *TaskStore) GetByID(ctx context.Context, taskId int64) (model.Task, error) {
 	const op = "postgres.task.GetByID"
 
-	const query = `
-		SELECT id, state, created_at, process_started_at, process_ended_at
-		FROM tasks
-		WHERE id = $1
-	`
-	var task model.Task
-	row := s.db.QueryRow(ctx, query, taskId)
-	err := row.Scan(
-		&task.ID,
-		&task.State,
-		&task.CreatedAt,
-		&task.ProcessStartedAt,
-		&task.ProcessEndedAt,
-	)
+	const query = `SELECT ` + taskColumns + ` FROM tasks WHERE id = $1`
+	task, err := scanTask(s.db.QueryRow(ctx, query, taskId))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Task{}, store.ErrTaskNotFound
+	}
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return model.Task{}, fmt.Errorf("%s: task with ID %d not found", op, taskId)
-		}
 		return model.Task{}, fmt.Errorf("%s: %s", op, err)
 	}
+
+	const dependencies = `SELECT depends_on_id FROM task_dependencies WHERE task_id = $1 ORDER BY depends_on_id`
+	rows, err := s.db.Query(ctx, dependencies, taskId)
+	if err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	task.DependsOn, err = pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	if len(task.DependsOn) == 0 {
+		task.DependsOn = nil
+	}
 	return task, nil
 }
 
+// Update overwrites the mutable state of a task. It returns store.ErrTaskNotFound if there is no such task
 func (s *TaskStore) Update(ctx context.Context, task model.Task) error {
 	const op = "postgres.task.Update"
 
-	const query = `
-		UPDATE tasks
-		SET state = $1, process_started_at = $2, process_ended_at = $3
-		WHERE id = $4
-	`
-	_, err := s.db.Exec(ctx, query, task.State, task.ProcessStartedAt, task.ProcessEndedAt, task.ID)
+	// The change is notified in the same statement, so listeners never see a change which was not committed
+	query := `
+		WITH changed AS (
+			UPDATE tasks
+			SET state = $1, process_started_at = $2, process_ended_at = $3, lease_expires_at = $4,
+				attempts = $5, next_run_at = $6, result = $7, error_message = $8, error_code = $9
+			WHERE id = $10
+			RETURNING id, state
+		)
+		SELECT 1 FROM changed, ` + fmt.Sprintf(notifyChange, 11)
+	tag, err := s.db.Exec(
+		ctx, query,
+		task.State, task.ProcessStartedAt, task.ProcessEndedAt, task.LeaseExpiresAt,
+		task.Attempts, task.NextRunAt, task.Result, task.Error, task.ErrorCode, task.ID, s.instanceID,
+	)
 	if err != nil {
 		return fmt.Errorf("%s: %s", op, err)
 	}
+	// The statement selects a row for every updated task
+	if tag.RowsAffected() == 0 {
+		return store.ErrTaskNotFound
+	}
 	return nil
 }
 
-func (s *TaskStore) GetAll(ctx context.Context) ([]model.Task, error) {
+// SaveAttempt overwrites the mutable state of a task like Update if the task is still processing attempt.
+// It returns store.ErrLeaseLost otherwise, e.g. if the task was cancelled or recovered meanwhile
+func (s *TaskStore) SaveAttempt(ctx context.Context, task model.Task, attempt int) error {
+	const op = "postgres.task.SaveAttempt"
+
+	query := `
+		WITH changed AS (
+			UPDATE tasks
+			SET state = $1, process_started_at = $2, process_ended_at = $3, lease_expires_at = $4,
+				attempts = $5, next_run_at = $6, result = $7, error_message = $8, error_code = $9
+			WHERE id = $10 AND state = $12 AND attempts = $13
+			RETURNING id, state
+		)
+		SELECT 1 FROM changed, ` + fmt.Sprintf(notifyChange, 11)
+	tag, err := s.db.Exec(
+		ctx, query,
+		task.State, task.ProcessStartedAt, task.ProcessEndedAt, task.LeaseExpiresAt,
+		task.Attempts, task.NextRunAt, task.Result, task.Error, task.ErrorCode, task.ID, s.instanceID,
+		model.ProcessingState, attempt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %s", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return store.ErrLeaseLost
+	}
+	return nil
+}
+
+// GetAll returns tasks matching filter
+func (s *TaskStore) GetAll(ctx context.Context, filter model.TaskFilter) ([]model.Task, error) {
 	const op = "postgres.task.GetAll"
 
-	const query = `
-		SELECT id, state, created_at, process_started_at, process_ended_at FROM tasks
+	var (
+		conditions []string
+		args       []any
+	)
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if len(filter.States) > 0 {
+		states := make([]string, len(filter.States))
+		for i, state := range filter.States {
+			states[i] = string(state)
+		}
+		where("state = ANY($%d)", states)
+	}
+	if filter.ParentID != nil {
+		where("parent_id = $%d", *filter.ParentID)
+	}
+	if filter.CreatedAfter != nil {
+		where("created_at >= $%d", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		where("created_at < $%d", *filter.CreatedBefore)
+	}
+	order := "ASC"
+	if filter.Descending {
+		order = "DESC"
+		if filter.AfterID > 0 {
+			where("id < $%d", filter.AfterID)
+		}
+	} else if filter.AfterID > 0 {
+		where("id > $%d", filter.AfterID)
+	}
+
+	query := `SELECT ` + taskColumns + ` FROM tasks`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY id ` + order
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+
+	var tasks []model.Task
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+		tasks = append(tasks, task)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	return tasks, nil
+}
+
+// claimCandidates is how many of the tasks with the highest priority and of the oldest tasks are ranked
+// with aging when a task is claimed
+const claimCandidates = 100
+
+// Claim atomically moves the pending or due retrying task of one of types with the highest priority to processing
+// state, counts the attempt, leases the task for lease duration and returns it. A task gains one priority level
+// for every aging interval it has been waiting since it became due, ties go to the oldest task. Only the tasks
+// with the highest priority and the oldest tasks are ranked, so a claim does not scan the whole queue while
+// aged tasks still get their turn. Rows locked by other workers are skipped, so several instances can claim tasks from the same table
+func (s *TaskStore) Claim(
+	ctx context.Context,
+	lease time.Duration,
+	types []string,
+	aging time.Duration,
+) (model.Task, error) {
+	const op = "postgres.task.Claim"
+
+	// Candidates are listed by the partial indexes of the queue. Their states are spelled out, as the planner
+	// cannot match the indexes by parameters in a generic plan
+	query := `
+		WITH changed AS (
+			UPDATE tasks
+			SET state = $1, process_started_at = $2, lease_expires_at = $3, attempts = attempts + 1, next_run_at = NULL
+			WHERE id = (
+				SELECT id FROM tasks
+				WHERE id IN (
+					(
+						SELECT id FROM tasks
+						WHERE state IN ('PENDING', 'RETRYING') AND (state = $4 OR (state = $5 AND next_run_at <= $2))
+							AND type = ANY($6)
+						ORDER BY priority DESC, id
+						LIMIT $9
+					)
+					UNION
+					(
+						SELECT id FROM tasks
+						WHERE state IN ('PENDING', 'RETRYING') AND (state = $4 OR (state = $5 AND next_run_at <= $2))
+							AND type = ANY($6)
+						ORDER BY id
+						LIMIT $9
+					)
+				)
+				AND (state = $4 OR (state = $5 AND next_run_at <= $2))
+				ORDER BY
+					priority + COALESCE(
+						floor(extract(EPOCH FROM $2 - COALESCE(next_run_at, run_at, created_at)) / NULLIF($8::float8, 0)), 0
+					) DESC,
+					id
+				LIMIT 1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING ` + taskColumns + `
+		)
+		SELECT ` + taskColumns + ` FROM changed, ` + fmt.Sprintf(notifyChange, 7)
+	now := time.Now()
+	task, err := scanTask(s.db.QueryRow(
+		ctx, query,
+		model.ProcessingState, now, now.Add(lease), model.PendingState, model.RetryingState, types, s.instanceID,
+		aging.Seconds(), claimCandidates,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.Task{}, store.ErrNoPendingTasks
+		}
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	return task, nil
+}
+
+// PromoteDue moves scheduled tasks whose run time is not after now to pending state and returns them
+func (s *TaskStore) PromoteDue(ctx context.Context, now time.Time) ([]model.Task, error) {
+	const op = "postgres.task.PromoteDue"
+
+	query := `
+		WITH changed AS (
+			UPDATE tasks
+			SET state = $1
+			WHERE state = $2 AND run_at <= $3
+			RETURNING ` + taskColumns + `
+		)
+		SELECT ` + taskColumns + ` FROM changed, ` + fmt.Sprintf(notifyChange, 4) + `
+		ORDER BY id
 	`
+	rows, err := s.db.Query(ctx, query, model.PendingState, model.ScheduledState, now, s.instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	defer rows.Close()
+
 	var tasks []model.Task
-	rows, err := s.db.Query(ctx, query)
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	return tasks, nil
+}
+
+// ResolveDependencies moves waiting tasks whose dependencies have all completed to pending or scheduled state
+// and fails waiting tasks with a dependency which finished without completing. It returns the changed tasks
+func (s *TaskStore) ResolveDependencies(ctx context.Context, now time.Time) ([]model.Task, error) {
+	const op = "postgres.task.ResolveDependencies"
+
+	query := `
+		WITH resolved AS (
+			SELECT
+				d.task_id AS waiting_id,
+				bool_and(parent.state = $2) AS ready,
+				bool_or(parent.state IN ($3, $4, $5)) AS broken
+			FROM task_dependencies d
+			JOIN tasks waiting ON waiting.id = d.task_id
+			JOIN tasks parent ON parent.id = d.depends_on_id
+			WHERE waiting.state = $1
+			GROUP BY d.task_id
+		), changed AS (
+			UPDATE tasks
+			SET
+				state = CASE
+					WHEN resolved.broken THEN $3
+					WHEN tasks.run_at > $6 THEN $7
+					ELSE $8
+				END,
+				process_ended_at = CASE WHEN resolved.broken THEN $6 END,
+				error_message = CASE WHEN resolved.broken THEN $9 ELSE error_message END,
+				error_code = CASE WHEN resolved.broken THEN $10 ELSE error_code END
+			FROM resolved
+			WHERE tasks.id = resolved.waiting_id AND tasks.state = $1 AND (resolved.ready OR resolved.broken)
+			RETURNING ` + taskColumns + `
+		)
+		SELECT ` + taskColumns + ` FROM changed, ` + fmt.Sprintf(notifyChange, 11) + `
+		ORDER BY id
+	`
+	rows, err := s.db.Query(
+		ctx, query,
+		model.WaitingState, model.CompletedState, model.FailedState, model.CancelledState, model.TimedOutState,
+		now, model.ScheduledState, model.PendingState,
+		store.ErrDependencyFailed.Error(), model.DependencyFailedErrorCode, s.instanceID,
+	)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %s", op, err)
 	}
 	defer rows.Close()
 
+	var tasks []model.Task
 	for rows.Next() {
-		var task model.Task
-		err := rows.Scan(
-			&task.ID,
-			&task.State,
-			&task.CreatedAt,
-			&task.ProcessStartedAt,
-			&task.ProcessEndedAt,
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	return tasks, nil
+}
+
+// CompleteParents completes tasks awaiting children whose children have all finished, whatever their outcome.
+// The result of a completed parent aggregates its own result and the results of its children. It returns
+// the completed tasks
+func (s *TaskStore) CompleteParents(ctx context.Context, now time.Time) ([]model.Task, error) {
+	const op = "postgres.task.CompleteParents"
+
+	query := `
+		WITH ready AS (
+			SELECT
+				parent.id AS parent_id,
+				jsonb_agg(
+					jsonb_build_object('id', child.id, 'state', child.state)
+					|| CASE WHEN child.result IS NULL THEN '{}'::jsonb
+						ELSE jsonb_build_object('result', child.result) END
+					|| CASE WHEN child.error_message = '' THEN '{}'::jsonb
+						ELSE jsonb_build_object('error', child.error_message, 'error_code', child.error_code) END
+					ORDER BY child.id
+				) AS children
+			FROM tasks parent
+			JOIN tasks child ON child.parent_id = parent.id
+			WHERE parent.state = $1
+			GROUP BY parent.id
+			HAVING bool_and(child.state IN ($2, $3, $4, $5))
+		), changed AS (
+			UPDATE tasks
+			SET
+				state = $2,
+				process_ended_at = $6,
+				result = jsonb_build_object('children', ready.children)
+					|| CASE WHEN tasks.result IS NULL THEN '{}'::jsonb
+						ELSE jsonb_build_object('result', tasks.result) END
+			FROM ready
+			WHERE tasks.id = ready.parent_id AND tasks.state = $1
+			RETURNING ` + taskColumns + `
 		)
+		SELECT ` + taskColumns + ` FROM changed, ` + fmt.Sprintf(notifyChange, 7) + `
+		ORDER BY id
+	`
+	rows, err := s.db.Query(
+		ctx, query,
+		model.AwaitingChildrenState, model.CompletedState, model.FailedState, model.CancelledState, model.TimedOutState,
+		now, s.instanceID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	defer rows.Close()
+
+	var tasks []model.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
 		if err != nil {
 			return nil, fmt.Errorf("%s: %s", op, err)
 		}
 		tasks = append(tasks, task)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	return tasks, nil
+}
+
+// ExtendLease prolongs the lease of a task processing attempt. It returns store.ErrLeaseLost if the task
+// is no longer processing that attempt, e.g. because its lease has already expired and it was recovered
+func (s *TaskStore) ExtendLease(ctx context.Context, taskID int64, attempt int, lease time.Duration) error {
+	const op = "postgres.task.ExtendLease"
+
+	const query = `UPDATE tasks SET lease_expires_at = $1 WHERE id = $2 AND state = $3 AND attempts = $4`
+	tag, err := s.db.Exec(ctx, query, time.Now().Add(lease), taskID, model.ProcessingState, attempt)
+	if err != nil {
+		return fmt.Errorf("%s: %s", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return store.ErrLeaseLost
+	}
+	return nil
+}
+
+// ReleaseExpired moves processing tasks whose lease expired before now to state.
+// Requeued tasks lose their start time, failed ones get an end time and an error. It returns the released tasks
+func (s *TaskStore) ReleaseExpired(ctx context.Context, now time.Time, state model.TaskState) ([]model.Task, error) {
+	const op = "postgres.task.ReleaseExpired"
+
+	release := `
+		UPDATE tasks
+		SET state = $1, lease_expires_at = NULL, process_ended_at = $2, error_message = $4, error_code = $5
+		WHERE state = $3 AND lease_expires_at < $2
+		RETURNING ` + taskColumns
+	if state == model.PendingState {
+		release = `
+			UPDATE tasks
+			SET state = $1, lease_expires_at = NULL, process_started_at = NULL, error_message = $4, error_code = $5
+			WHERE state = $3 AND lease_expires_at < $2
+			RETURNING ` + taskColumns
+	}
+	query := `
+		WITH changed AS (` + release + `)
+		SELECT ` + taskColumns + ` FROM changed, ` + fmt.Sprintf(notifyChange, 6) + `
+		ORDER BY id
+	`
+	rows, err := s.db.Query(
+		ctx, query,
+		state, now, model.ProcessingState, store.ErrLeaseExpired.Error(), model.LeaseExpiredErrorCode, s.instanceID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	defer rows.Close()
 
+	var tasks []model.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+		tasks = append(tasks, task)
+	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("%s: %s", op, err)
 	}
 	return tasks, nil
 }
+
+// Cancel moves a scheduled, waiting, pending, retrying, processing or awaiting children task to cancelled state
+// and returns it.
+// It returns store.ErrTaskFinished if the task has already finished
+func (s *TaskStore) Cancel(ctx context.Context, taskID int64, now time.Time) (model.Task, error) {
+	const op = "postgres.task.Cancel"
+
+	query := `
+		WITH changed AS (
+			UPDATE tasks
+			SET state = $1, process_ended_at = $2, lease_expires_at = NULL, next_run_at = NULL
+			WHERE id = $3 AND state IN ($4, $5, $6, $7, $8, $9)
+			RETURNING ` + taskColumns + `
+		)
+		SELECT ` + taskColumns + ` FROM changed, ` + fmt.Sprintf(notifyChange, 10)
+	task, err := scanTask(s.db.QueryRow(
+		ctx, query,
+		model.CancelledState, now, taskID,
+		model.ScheduledState, model.WaitingState, model.PendingState, model.RetryingState, model.ProcessingState,
+		model.AwaitingChildrenState, s.instanceID,
+	))
+	if err == nil {
+		return task, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+
+	var exists bool
+	err = s.db.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1)`, taskID).Scan(&exists)
+	if err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	if !exists {
+		return model.Task{}, store.ErrTaskNotFound
+	}
+	return model.Task{}, store.ErrTaskFinished
+}
+
+func (s *TaskStore) CountByState(ctx context.Context, state model.TaskState) (int, error) {
+	const op = "postgres.task.CountByState"
+
+	const query = `SELECT count(*) FROM tasks WHERE state = $1`
+	var count int
+	err := s.db.QueryRow(ctx, query, state).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", op, err)
+	}
+	return count, nil
+}
@@ -0,0 +1,51 @@
+package postgres_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+	"io-load-api/internal/config"
+	"io-load-api/internal/service"
+	"io-load-api/internal/store/postgres"
+	"io-load-api/internal/store/storetest"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+// TestTaskStore_Conformance runs against the migrated database configured by the file in TEST_CONFIG_PATH.
+// Tables of the database are truncated
+func TestTaskStore_Conformance(t *testing.T) {
+	cfg := testConfig(t)
+
+	db, err := postgres.New(slog.Default(), &cfg)
+	require.NoError(t, err)
+	conn, err := pgx.Connect(context.Background(), fmt.Sprintf(
+		"postgres://%s:%s@%s:%s/%s?sslmode=disable",
+		cfg.PostgresDB.Username, cfg.PostgresDB.Password, cfg.PostgresDB.Host, cfg.PostgresDB.Port, cfg.PostgresDB.DBName,
+	))
+	require.NoError(t, err)
+	defer conn.Close(context.Background())
+
+	storetest.Run(t, func(t *testing.T) service.Store {
+		_, err := conn.Exec(
+			context.Background(), `TRUNCATE tasks, task_dependencies, webhook_deliveries RESTART IDENTITY CASCADE`,
+		)
+		require.NoError(t, err)
+		return postgres.NewTaskStore(db)
+	})
+}
+
+// testConfig reads the config of the test database from the file in TEST_CONFIG_PATH and skips the test
+// if it is not set
+func testConfig(t *testing.T) config.Config {
+	configPath, ok := os.LookupEnv("TEST_CONFIG_PATH")
+	if !ok {
+		t.Skip("TEST_CONFIG_PATH is not set")
+	}
+	var cfg config.Config
+	require.NoError(t, cleanenv.ReadConfig(configPath, &cfg))
+	return cfg
+}
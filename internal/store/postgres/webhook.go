@@ -0,0 +1,34 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"io-load-api/internal/model"
+)
+
+type DeliveryStore struct {
+	Store
+}
+
+func NewDeliveryStore(store Store) *DeliveryStore {
+	return &DeliveryStore{store}
+}
+
+// LogDelivery records an attempt to deliver a task webhook
+func (s *DeliveryStore) LogDelivery(ctx context.Context, delivery model.WebhookDelivery) error {
+	const op = "postgres.webhook.LogDelivery"
+
+	const query = `
+		INSERT INTO webhook_deliveries (task_id, url, attempt, status_code, error_message, delivered, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := s.db.Exec(
+		ctx, query,
+		delivery.TaskID, delivery.URL, delivery.Attempt, delivery.StatusCode, delivery.Error, delivery.Delivered,
+		delivery.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %s", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"io-load-api/internal/model"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ScheduleStore is in-memory store of schedules which creates tasks in tasks
+type ScheduleStore struct {
+	tasks *TaskStore
+
+	mu     sync.Mutex
+	store  map[int64]model.Schedule
+	nextID int64
+}
+
+func NewScheduleStore(tasks *TaskStore) *ScheduleStore {
+	return &ScheduleStore{
+		tasks: tasks,
+		store: make(map[int64]model.Schedule),
+	}
+}
+
+// Create stores schedule with the next ID
+func (s *ScheduleStore) Create(_ context.Context, schedule model.Schedule) (model.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	schedule.ID = s.nextID
+	schedule.CreatedAt = time.Now()
+	s.store[schedule.ID] = schedule
+	return schedule, nil
+}
+
+func (s *ScheduleStore) GetByID(_ context.Context, scheduleID int64) (model.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, ok := s.store[scheduleID]
+	if !ok {
+		return model.Schedule{}, ErrScheduleNotFound
+	}
+	return schedule, nil
+}
+
+// GetAll returns all schedules ordered by ID
+func (s *ScheduleStore) GetAll(_ context.Context) ([]model.Schedule, error) {
+	return s.filter(func(model.Schedule) bool { return true }), nil
+}
+
+// GetDue returns schedules whose next activation is not after now
+func (s *ScheduleStore) GetDue(_ context.Context, now time.Time) ([]model.Schedule, error) {
+	return s.filter(func(schedule model.Schedule) bool { return !schedule.NextRunAt.After(now) }), nil
+}
+
+func (s *ScheduleStore) filter(matches func(model.Schedule) bool) []model.Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var schedules []model.Schedule
+	for _, schedule := range s.store {
+		if matches(schedule) {
+			schedules = append(schedules, schedule)
+		}
+	}
+	slices.SortFunc(schedules, func(a, b model.Schedule) int { return cmp.Compare(a.ID, b.ID) })
+	return schedules
+}
+
+func (s *ScheduleStore) Delete(_ context.Context, scheduleID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.store[scheduleID]; !ok {
+		return ErrScheduleNotFound
+	}
+	delete(s.store, scheduleID)
+	return nil
+}
+
+// Fire creates task for the activation schedule.NextRunAt and moves the schedule to its next activation.
+// If the activation was already fired or the schedule was deleted, it returns ErrScheduleNotDue
+func (s *ScheduleStore) Fire(
+	ctx context.Context,
+	schedule model.Schedule,
+	next time.Time,
+	task model.Task,
+) (model.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.store[schedule.ID]
+	if !ok || !stored.NextRunAt.Equal(schedule.NextRunAt) {
+		return model.Task{}, ErrScheduleNotDue
+	}
+	created, err := s.tasks.Create(ctx, task)
+	if err != nil {
+		return model.Task{}, err
+	}
+	lastRunAt := stored.NextRunAt
+	stored.LastRunAt = &lastRunAt
+	stored.NextRunAt = next
+	s.store[schedule.ID] = stored
+	return created, nil
+}
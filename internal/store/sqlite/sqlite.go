@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io-load-api/internal/config"
+	"log/slog"
+	_ "modernc.org/sqlite"
+	"net/url"
+	"time"
+)
+
+// Store keeps tasks in a SQLite database file. Writes are serialized by the database lock, so several processes
+// on the same host may share the file, but they are not notified about changes made by each other
+type Store struct {
+	db *sql.DB
+}
+
+func New(log *slog.Logger, cfg *config.Config) (Store, error) {
+	// Transactions take the write lock right away, so they wait for other writers instead of failing on upgrade
+	query := url.Values{}
+	query.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", cfg.SQLite.BusyTimeout.Milliseconds()))
+	query.Add("_pragma", "journal_mode(WAL)")
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Set("_txlock", "immediate")
+	dsn := "file:" + cfg.SQLite.Path + "?" + query.Encode()
+
+	log.Info("Opening SQLite database", slog.String("path", cfg.SQLite.Path))
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return Store{}, fmt.Errorf("failed to open sqlite database: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return Store{}, fmt.Errorf("failed to open sqlite database: %s", err)
+	}
+	return Store{db: db}, nil
+}
+
+// querier is implemented by both the database and transactions
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// nullUnixMicro converts t to a stored timestamp, nil t is stored as NULL. Timestamps are stored
+// as Unix times in microseconds, the precision of Postgres timestamps
+func nullUnixMicro(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UnixMicro()
+}
+
+// nullTime scans a nullable stored timestamp into *time.Time
+type nullTime struct {
+	dst **time.Time
+}
+
+func (t nullTime) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*t.dst = nil
+	case int64:
+		parsed := time.UnixMicro(v)
+		*t.dst = &parsed
+	default:
+		return fmt.Errorf("unsupported timestamp type %T", src)
+	}
+	return nil
+}
+
+// nullJSON converts a JSON document to text, nil document is stored as NULL
+func nullJSON(document json.RawMessage) any {
+	if document == nil {
+		return nil
+	}
+	return string(document)
+}
+
+// jsonText scans a nullable JSON text column into json.RawMessage
+type jsonText struct {
+	dst *json.RawMessage
+}
+
+func (j jsonText) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*j.dst = nil
+	case string:
+		*j.dst = json.RawMessage(v)
+	case []byte:
+		*j.dst = append(json.RawMessage(nil), v...)
+	default:
+		return fmt.Errorf("unsupported JSON type %T", src)
+	}
+	return nil
+}
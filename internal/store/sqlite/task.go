@@ -0,0 +1,678 @@
+package sqlite
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io-load-api/internal/model"
+	"io-load-api/internal/store"
+	"slices"
+	"strings"
+	"time"
+)
+
+type TaskStore struct {
+	Store
+}
+
+func NewTaskStore(store Store) *TaskStore {
+	return &TaskStore{store}
+}
+
+// taskColumns lists columns in the order expected by scanTask
+const taskColumns = `
+	id, type, state, created_at, process_started_at, process_ended_at, lease_expires_at,
+	attempts, max_attempts, retry_base_delay_ms, retry_multiplier, retry_jitter, next_run_at,
+	timeout_ms, deadline, payload, result, error_message, error_code, callback_url, idempotency_key, request_hash,
+	priority, run_at, parent_id
+`
+
+// rowScanner is implemented by both sql.Row and sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTask(row rowScanner) (model.Task, error) {
+	var (
+		task           model.Task
+		createdAt      int64
+		baseDelayMs    int64
+		timeoutMs      int64
+		idempotencyKey sql.NullString
+		parentID       sql.NullInt64
+	)
+	err := row.Scan(
+		&task.ID,
+		&task.Type,
+		&task.State,
+		&createdAt,
+		nullTime{&task.ProcessStartedAt},
+		nullTime{&task.ProcessEndedAt},
+		nullTime{&task.LeaseExpiresAt},
+		&task.Attempts,
+		&task.RetryPolicy.MaxAttempts,
+		&baseDelayMs,
+		&task.RetryPolicy.Multiplier,
+		&task.RetryPolicy.Jitter,
+		nullTime{&task.NextRunAt},
+		&timeoutMs,
+		nullTime{&task.Deadline},
+		jsonText{&task.Payload},
+		jsonText{&task.Result},
+		&task.Error,
+		&task.ErrorCode,
+		&task.CallbackURL,
+		&idempotencyKey,
+		&task.RequestHash,
+		&task.Priority,
+		nullTime{&task.RunAt},
+		&parentID,
+	)
+	task.CreatedAt = time.UnixMicro(createdAt)
+	task.IdempotencyKey = idempotencyKey.String
+	if parentID.Valid {
+		task.ParentID = &parentID.Int64
+	}
+	task.RetryPolicy.BaseDelay = time.Duration(baseDelayMs) * time.Millisecond
+	task.Timeout = time.Duration(timeoutMs) * time.Millisecond
+	return task, err
+}
+
+// collectTasks scans all rows into tasks ordered by ID
+func collectTasks(rows *sql.Rows) ([]model.Task, error) {
+	defer rows.Close()
+
+	var tasks []model.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(tasks, func(a, b model.Task) int { return cmp.Compare(a.ID, b.ID) })
+	return tasks, nil
+}
+
+// Create inserts a new pending, scheduled or waiting task with options taken from task.
+// If another task has the same idempotency key, it returns that task and store.ErrDuplicateKey
+func (s *TaskStore) Create(ctx context.Context, task model.Task) (model.Task, error) {
+	const op = "sqlite.task.Create"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	defer tx.Rollback()
+
+	created, err := insertTask(ctx, tx, task)
+	if errors.Is(err, sql.ErrNoRows) && task.IdempotencyKey != "" {
+		existing, err := s.GetByIdempotencyKey(ctx, task.IdempotencyKey)
+		if err != nil {
+			return model.Task{}, fmt.Errorf("%s: %w", op, err)
+		}
+		return existing, store.ErrDuplicateKey
+	}
+	if err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	if err := insertDependencies(ctx, tx, created.ID, task.DependsOn); err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	created.DependsOn = task.DependsOn
+	return created, nil
+}
+
+// insertTask inserts task with q. It returns sql.ErrNoRows if another task has the same idempotency key
+func insertTask(ctx context.Context, q querier, task model.Task) (model.Task, error) {
+	const query = `
+		INSERT INTO tasks (
+			type, max_attempts, retry_base_delay_ms, retry_multiplier, retry_jitter, timeout_ms, deadline, payload,
+			callback_url, idempotency_key, request_hash, priority, state, run_at, parent_id, created_at
+		)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, NULLIF(?10, ''), ?11, ?12, ?13, ?14, ?15, ?16)
+		ON CONFLICT (idempotency_key) DO NOTHING
+		RETURNING ` + taskColumns
+	return scanTask(q.QueryRowContext(
+		ctx, query,
+		task.Type,
+		task.RetryPolicy.MaxAttempts,
+		task.RetryPolicy.BaseDelay.Milliseconds(),
+		task.RetryPolicy.Multiplier,
+		task.RetryPolicy.Jitter,
+		task.Timeout.Milliseconds(),
+		nullUnixMicro(task.Deadline),
+		nullJSON(task.Payload),
+		task.CallbackURL,
+		task.IdempotencyKey,
+		task.RequestHash,
+		task.Priority,
+		store.InitialState(task),
+		nullUnixMicro(task.RunAt),
+		task.ParentID,
+		time.Now().UnixMicro(),
+	))
+}
+
+// insertDependencies records that the task with taskID depends on tasks with parentIDs
+func insertDependencies(ctx context.Context, q querier, taskID int64, parentIDs []int64) error {
+	for _, parentID := range parentIDs {
+		const query = `INSERT OR IGNORE INTO task_dependencies (task_id, depends_on_id) VALUES (?1, ?2)`
+		if _, err := q.ExecContext(ctx, query, taskID, parentID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateBatch inserts tasks as new pending, scheduled or waiting tasks in one transaction and returns
+// the stored tasks in the order of tasks
+func (s *TaskStore) CreateBatch(ctx context.Context, tasks []model.Task) ([]model.Task, error) {
+	return s.CreateWorkflow(ctx, tasks, nil)
+}
+
+// CreateWorkflow inserts tasks like CreateBatch. Task i also depends on tasks whose indexes are listed
+// in dependencies[i], in addition to its own DependsOn
+func (s *TaskStore) CreateWorkflow(ctx context.Context, tasks []model.Task, dependencies [][]int) ([]model.Task, error) {
+	const op = "sqlite.task.CreateWorkflow"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	defer tx.Rollback()
+
+	created := make([]model.Task, len(tasks))
+	for i, task := range tasks {
+		if i < len(dependencies) && len(dependencies[i]) > 0 {
+			task.State = model.WaitingState
+		}
+		created[i], err = insertTask(ctx, tx, task)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+	}
+
+	// Dependencies within the workflow may refer to tasks inserted after the dependent one
+	for i, task := range tasks {
+		parentIDs := slices.Clone(task.DependsOn)
+		if i < len(dependencies) {
+			for _, parent := range dependencies[i] {
+				parentIDs = append(parentIDs, created[parent].ID)
+			}
+		}
+		if err := insertDependencies(ctx, tx, created[i].ID, parentIDs); err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+		created[i].DependsOn = parentIDs
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	return created, nil
+}
+
+// GetByIdempotencyKey returns the task created with key or store.ErrTaskNotFound
+func (s *TaskStore) GetByIdempotencyKey(ctx context.Context, key string) (model.Task, error) {
+	const op = "sqlite.task.GetByIdempotencyKey"
+
+	const query = `SELECT ` + taskColumns + ` FROM tasks WHERE idempotency_key = ?1`
+	task, err := scanTask(s.db.QueryRowContext(ctx, query, key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Task{}, store.ErrTaskNotFound
+	}
+	if err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	return task, nil
+}
+
+// GetByID returns the task with taskID and the tasks it depends on or store.ErrTaskNotFound
+func (s *TaskStore) GetByID(ctx context.Context, taskID int64) (model.Task, error) {
+	const op = "sqlite.task.GetByID"
+
+	const query = `SELECT ` + taskColumns + ` FROM tasks WHERE id = ?1`
+	task, err := scanTask(s.db.QueryRowContext(ctx, query, taskID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Task{}, store.ErrTaskNotFound
+	}
+	if err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+
+	const dependencies = `SELECT depends_on_id FROM task_dependencies WHERE task_id = ?1 ORDER BY depends_on_id`
+	rows, err := s.db.QueryContext(ctx, dependencies, taskID)
+	if err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var parentID int64
+		if err := rows.Scan(&parentID); err != nil {
+			return model.Task{}, fmt.Errorf("%s: %s", op, err)
+		}
+		task.DependsOn = append(task.DependsOn, parentID)
+	}
+	if err := rows.Err(); err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	return task, nil
+}
+
+// Update overwrites the mutable state of a task. It returns store.ErrTaskNotFound if there is no such task
+func (s *TaskStore) Update(ctx context.Context, task model.Task) error {
+	const op = "sqlite.task.Update"
+
+	const query = `
+		UPDATE tasks
+		SET state = ?1, process_started_at = ?2, process_ended_at = ?3, lease_expires_at = ?4,
+			attempts = ?5, next_run_at = ?6, result = ?7, error_message = ?8, error_code = ?9
+		WHERE id = ?10
+	`
+	result, err := s.db.ExecContext(
+		ctx, query,
+		task.State,
+		nullUnixMicro(task.ProcessStartedAt),
+		nullUnixMicro(task.ProcessEndedAt),
+		nullUnixMicro(task.LeaseExpiresAt),
+		task.Attempts,
+		nullUnixMicro(task.NextRunAt),
+		nullJSON(task.Result),
+		task.Error,
+		task.ErrorCode,
+		task.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %s", op, err)
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("%s: %s", op, err)
+	} else if updated == 0 {
+		return store.ErrTaskNotFound
+	}
+	return nil
+}
+
+// SaveAttempt overwrites the mutable state of a task like Update if the task is still processing attempt.
+// It returns store.ErrLeaseLost otherwise, e.g. if the task was cancelled or recovered meanwhile
+func (s *TaskStore) SaveAttempt(ctx context.Context, task model.Task, attempt int) error {
+	const op = "sqlite.task.SaveAttempt"
+
+	const query = `
+		UPDATE tasks
+		SET state = ?1, process_started_at = ?2, process_ended_at = ?3, lease_expires_at = ?4,
+			attempts = ?5, next_run_at = ?6, result = ?7, error_message = ?8, error_code = ?9
+		WHERE id = ?10 AND state = ?11 AND attempts = ?12
+	`
+	result, err := s.db.ExecContext(
+		ctx, query,
+		task.State,
+		nullUnixMicro(task.ProcessStartedAt),
+		nullUnixMicro(task.ProcessEndedAt),
+		nullUnixMicro(task.LeaseExpiresAt),
+		task.Attempts,
+		nullUnixMicro(task.NextRunAt),
+		nullJSON(task.Result),
+		task.Error,
+		task.ErrorCode,
+		task.ID,
+		model.ProcessingState,
+		attempt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %s", op, err)
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("%s: %s", op, err)
+	} else if updated == 0 {
+		return store.ErrLeaseLost
+	}
+	return nil
+}
+
+// GetAll returns tasks matching filter
+func (s *TaskStore) GetAll(ctx context.Context, filter model.TaskFilter) ([]model.Task, error) {
+	const op = "sqlite.task.GetAll"
+
+	var (
+		conditions []string
+		args       []any
+	)
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if len(filter.States) > 0 {
+		states, err := json.Marshal(filter.States)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+		where("state IN (SELECT value FROM json_each(?%d))", string(states))
+	}
+	if filter.ParentID != nil {
+		where("parent_id = ?%d", *filter.ParentID)
+	}
+	if filter.CreatedAfter != nil {
+		where("created_at >= ?%d", filter.CreatedAfter.UnixMicro())
+	}
+	if filter.CreatedBefore != nil {
+		where("created_at < ?%d", filter.CreatedBefore.UnixMicro())
+	}
+	order := "ASC"
+	if filter.Descending {
+		order = "DESC"
+		if filter.AfterID > 0 {
+			where("id < ?%d", filter.AfterID)
+		}
+	} else if filter.AfterID > 0 {
+		where("id > ?%d", filter.AfterID)
+	}
+
+	query := `SELECT ` + taskColumns + ` FROM tasks`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY id ` + order
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(` LIMIT ?%d`, len(args))
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	defer rows.Close()
+
+	var tasks []model.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	return tasks, nil
+}
+
+// Claim atomically moves the pending or due retrying task of one of types with the highest priority to processing
+// state, counts the attempt, leases the task for lease duration and returns it. A task gains one priority level
+// for every aging interval it has been waiting since it became due, ties go to the oldest task.
+// The statement runs under the database write lock, so a task is claimed once even if processes share the file
+func (s *TaskStore) Claim(
+	ctx context.Context,
+	lease time.Duration,
+	types []string,
+	aging time.Duration,
+) (model.Task, error) {
+	const op = "sqlite.task.Claim"
+
+	typesJSON, err := json.Marshal(types)
+	if err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	const query = `
+		UPDATE tasks
+		SET state = ?1, process_started_at = ?2, lease_expires_at = ?3, attempts = attempts + 1, next_run_at = NULL
+		WHERE id = (
+			SELECT id FROM tasks
+			WHERE (state = ?4 OR (state = ?5 AND next_run_at <= ?2))
+				AND type IN (SELECT value FROM json_each(?6))
+			ORDER BY
+				priority + COALESCE(max(?2 - COALESCE(next_run_at, run_at, created_at), 0) / NULLIF(?7, 0), 0) DESC,
+				id
+			LIMIT 1
+		)
+		RETURNING ` + taskColumns
+	now := time.Now()
+	task, err := scanTask(s.db.QueryRowContext(
+		ctx, query,
+		model.ProcessingState, now.UnixMicro(), now.Add(lease).UnixMicro(), model.PendingState, model.RetryingState,
+		string(typesJSON), aging.Microseconds(),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Task{}, store.ErrNoPendingTasks
+	}
+	if err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	return task, nil
+}
+
+// PromoteDue moves scheduled tasks whose run time is not after now to pending state and returns them
+func (s *TaskStore) PromoteDue(ctx context.Context, now time.Time) ([]model.Task, error) {
+	const op = "sqlite.task.PromoteDue"
+
+	const query = `
+		UPDATE tasks
+		SET state = ?1
+		WHERE state = ?2 AND run_at <= ?3
+		RETURNING ` + taskColumns
+	rows, err := s.db.QueryContext(ctx, query, model.PendingState, model.ScheduledState, now.UnixMicro())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	tasks, err := collectTasks(rows)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	return tasks, nil
+}
+
+// ResolveDependencies moves waiting tasks whose dependencies have all completed to pending or scheduled state
+// and fails waiting tasks with a dependency which finished without completing. It returns the changed tasks
+func (s *TaskStore) ResolveDependencies(ctx context.Context, now time.Time) ([]model.Task, error) {
+	const op = "sqlite.task.ResolveDependencies"
+
+	const query = `
+		UPDATE tasks
+		SET
+			state = CASE
+				WHEN resolved.broken THEN ?3
+				WHEN tasks.run_at > ?6 THEN ?7
+				ELSE ?8
+			END,
+			process_ended_at = CASE WHEN resolved.broken THEN ?6 END,
+			error_message = CASE WHEN resolved.broken THEN ?9 ELSE error_message END,
+			error_code = CASE WHEN resolved.broken THEN ?10 ELSE error_code END
+		FROM (
+			SELECT
+				d.task_id AS waiting_id,
+				min(parent.state = ?2) AS ready,
+				max(parent.state IN (?3, ?4, ?5)) AS broken
+			FROM task_dependencies d
+			JOIN tasks waiting ON waiting.id = d.task_id
+			JOIN tasks parent ON parent.id = d.depends_on_id
+			WHERE waiting.state = ?1
+			GROUP BY d.task_id
+		) AS resolved
+		WHERE tasks.id = resolved.waiting_id AND tasks.state = ?1 AND (resolved.ready OR resolved.broken)
+		RETURNING ` + taskColumns
+	rows, err := s.db.QueryContext(
+		ctx, query,
+		model.WaitingState, model.CompletedState, model.FailedState, model.CancelledState, model.TimedOutState,
+		now.UnixMicro(), model.ScheduledState, model.PendingState,
+		store.ErrDependencyFailed.Error(), model.DependencyFailedErrorCode,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	tasks, err := collectTasks(rows)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	return tasks, nil
+}
+
+// CompleteParents completes tasks awaiting children whose children have all finished, whatever their outcome.
+// The result of a completed parent aggregates its own result and the results of its children. It returns
+// the completed tasks
+func (s *TaskStore) CompleteParents(ctx context.Context, now time.Time) ([]model.Task, error) {
+	const op = "sqlite.task.CompleteParents"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	defer tx.Rollback()
+
+	const ready = `
+		SELECT ` + taskColumns + ` FROM tasks parent
+		WHERE state = ?1 AND NOT EXISTS (
+			SELECT 1 FROM tasks child
+			WHERE child.parent_id = parent.id AND child.state NOT IN (?2, ?3, ?4, ?5)
+		)
+	`
+	rows, err := tx.QueryContext(
+		ctx, ready,
+		model.AwaitingChildrenState, model.CompletedState, model.FailedState, model.CancelledState, model.TimedOutState,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	parents, err := collectTasks(rows)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+
+	completed := make([]model.Task, 0, len(parents))
+	for _, parent := range parents {
+		rows, err := tx.QueryContext(ctx, `SELECT `+taskColumns+` FROM tasks WHERE parent_id = ?1`, parent.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+		children, err := collectTasks(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+		result, err := store.ParentResult(parent.Result, children)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+
+		const complete = `
+			UPDATE tasks SET state = ?1, process_ended_at = ?2, result = ?3
+			WHERE id = ?4
+			RETURNING ` + taskColumns
+		task, err := scanTask(tx.QueryRowContext(ctx, complete, model.CompletedState, now.UnixMicro(), string(result), parent.ID))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+		completed = append(completed, task)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	return completed, nil
+}
+
+// ExtendLease prolongs the lease of a task processing attempt. It returns store.ErrLeaseLost if the task
+// is no longer processing that attempt, e.g. because its lease has already expired and it was recovered
+func (s *TaskStore) ExtendLease(ctx context.Context, taskID int64, attempt int, lease time.Duration) error {
+	const op = "sqlite.task.ExtendLease"
+
+	const query = `UPDATE tasks SET lease_expires_at = ?1 WHERE id = ?2 AND state = ?3 AND attempts = ?4`
+	result, err := s.db.ExecContext(
+		ctx, query, time.Now().Add(lease).UnixMicro(), taskID, model.ProcessingState, attempt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %s", op, err)
+	}
+	if extended, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("%s: %s", op, err)
+	} else if extended == 0 {
+		return store.ErrLeaseLost
+	}
+	return nil
+}
+
+// ReleaseExpired moves processing tasks whose lease expired before now to state.
+// Requeued tasks lose their start time, failed ones get an end time and an error. It returns the released tasks
+func (s *TaskStore) ReleaseExpired(ctx context.Context, now time.Time, state model.TaskState) ([]model.Task, error) {
+	const op = "sqlite.task.ReleaseExpired"
+
+	query := `
+		UPDATE tasks
+		SET state = ?1, lease_expires_at = NULL, process_ended_at = ?2, error_message = ?4, error_code = ?5
+		WHERE state = ?3 AND lease_expires_at < ?2
+		RETURNING ` + taskColumns
+	if state == model.PendingState {
+		query = `
+			UPDATE tasks
+			SET state = ?1, lease_expires_at = NULL, process_started_at = NULL, error_message = ?4, error_code = ?5
+			WHERE state = ?3 AND lease_expires_at < ?2
+			RETURNING ` + taskColumns
+	}
+	rows, err := s.db.QueryContext(
+		ctx, query,
+		state, now.UnixMicro(), model.ProcessingState, store.ErrLeaseExpired.Error(), model.LeaseExpiredErrorCode,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	tasks, err := collectTasks(rows)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+	return tasks, nil
+}
+
+// Cancel moves a scheduled, waiting, pending, retrying, processing or awaiting children task to cancelled state
+// and returns it. It returns store.ErrTaskFinished if the task has already finished
+func (s *TaskStore) Cancel(ctx context.Context, taskID int64, now time.Time) (model.Task, error) {
+	const op = "sqlite.task.Cancel"
+
+	const query = `
+		UPDATE tasks
+		SET state = ?1, process_ended_at = ?2, lease_expires_at = NULL, next_run_at = NULL
+		WHERE id = ?3 AND state IN (?4, ?5, ?6, ?7, ?8, ?9)
+		RETURNING ` + taskColumns
+	task, err := scanTask(s.db.QueryRowContext(
+		ctx, query,
+		model.CancelledState, now.UnixMicro(), taskID,
+		model.ScheduledState, model.WaitingState, model.PendingState, model.RetryingState, model.ProcessingState,
+		model.AwaitingChildrenState,
+	))
+	if err == nil {
+		return task, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+
+	var exists bool
+	err = s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM tasks WHERE id = ?1)`, taskID).Scan(&exists)
+	if err != nil {
+		return model.Task{}, fmt.Errorf("%s: %s", op, err)
+	}
+	if !exists {
+		return model.Task{}, store.ErrTaskNotFound
+	}
+	return model.Task{}, store.ErrTaskFinished
+}
+
+func (s *TaskStore) CountByState(ctx context.Context, state model.TaskState) (int, error) {
+	const op = "sqlite.task.CountByState"
+
+	const query = `SELECT count(*) FROM tasks WHERE state = ?1`
+	var count int
+	err := s.db.QueryRowContext(ctx, query, state).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", op, err)
+	}
+	return count, nil
+}
@@ -0,0 +1,77 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io-load-api/internal/config"
+	"io-load-api/internal/model"
+	"io-load-api/internal/service"
+	"io-load-api/internal/store"
+	"io-load-api/internal/store/sqlite"
+	"io-load-api/internal/store/storetest"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newStore opens a database in a temporary file with the schema of migrations/sqlite applied
+func newStore(t *testing.T) sqlite.Store {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	migrations, err := filepath.Glob("../../../migrations/sqlite/*.up.sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for _, migration := range migrations {
+		schema, err := os.ReadFile(migration)
+		require.NoError(t, err)
+		_, err = db.Exec(string(schema))
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.Close())
+
+	s, err := sqlite.New(slog.Default(), &config.Config{SQLite: config.SQLite{Path: path, BusyTimeout: 5 * time.Second}})
+	require.NoError(t, err)
+	return s
+}
+
+func TestTaskStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) service.Store {
+		return sqlite.NewTaskStore(newStore(t))
+	})
+}
+
+func TestScheduleStore_Fire(t *testing.T) {
+	db := newStore(t)
+	schedules := sqlite.NewScheduleStore(db)
+	ctx := context.Background()
+
+	now := time.Now().Truncate(time.Minute)
+	schedule, err := schedules.Create(ctx, model.Schedule{
+		Cron:      "* * * * *",
+		Template:  model.TaskSpec{Type: "fetch_url"},
+		NextRunAt: now,
+	})
+	require.NoError(t, err)
+
+	due, err := schedules.GetDue(ctx, now)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, "fetch_url", due[0].Template.Type)
+
+	task, err := schedules.Fire(ctx, due[0], now.Add(time.Minute), model.Task{Type: "fetch_url"})
+	require.NoError(t, err)
+	assert.Equal(t, model.PendingState, task.State)
+	_, err = schedules.Fire(ctx, due[0], now.Add(time.Minute), model.Task{Type: "fetch_url"})
+	assert.ErrorIs(t, err, store.ErrScheduleNotDue)
+
+	assert.NoError(t, schedules.Delete(ctx, schedule.ID))
+	_, err = schedules.GetByID(ctx, schedule.ID)
+	assert.ErrorIs(t, err, store.ErrScheduleNotFound)
+}
@@ -3,5 +3,18 @@ package store
 import "errors"
 
 var (
-	ErrTaskNotFound = errors.New("task not found")
+	ErrTaskNotFound   = errors.New("task not found")
+	ErrNoPendingTasks = errors.New("no pending tasks")
+	ErrTaskFinished   = errors.New("task is already finished")
+	ErrLeaseExpired   = errors.New("task lease expired")
+	// ErrLeaseLost means the attempt no longer holds the task, e.g. because it was cancelled or recovered
+	// and claimed again
+	ErrLeaseLost    = errors.New("task lease lost")
+	ErrDuplicateKey = errors.New("idempotency key is already used")
+	// ErrDependencyFailed is the error of a task failed because a task it depends on did not complete
+	ErrDependencyFailed = errors.New("dependency did not complete")
+
+	ErrScheduleNotFound = errors.New("schedule not found")
+	// ErrScheduleNotDue means the activation was already fired, e.g. by another instance, or the schedule was deleted
+	ErrScheduleNotDue = errors.New("schedule is not due")
 )
@@ -0,0 +1,687 @@
+// Package storetest checks that an implementation of service.Store behaves like the others, so the service
+// works the same whatever storage is configured
+package storetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io-load-api/internal/model"
+	"io-load-api/internal/service"
+	"io-load-api/internal/store"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Run runs the conformance suite. Every test gets an empty store from newStore
+func Run(t *testing.T, newStore func(t *testing.T) service.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s service.Store)
+	}{
+		{"NotFound", testNotFound},
+		{"CreateAndGet", testCreateAndGet},
+		{"IdempotencyKey", testIdempotencyKey},
+		{"CreateBatch", testCreateBatch},
+		{"GetAllOrder", testGetAllOrder},
+		{"GetAllFilter", testGetAllFilter},
+		{"Update", testUpdate},
+		{"ClaimOrder", testClaimOrder},
+		{"ClaimRetrying", testClaimRetrying},
+		{"ConcurrentCreate", testConcurrentCreate},
+		{"ConcurrentClaim", testConcurrentClaim},
+		{"Lease", testLease},
+		{"LeaseFencing", testLeaseFencing},
+		{"ReleaseExpired", testReleaseExpired},
+		{"Cancel", testCancel},
+		{"CancelProcessing", testCancelProcessing},
+		{"PromoteDue", testPromoteDue},
+		{"ResolveDependencies", testResolveDependencies},
+		{"CompleteParents", testCompleteParents},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+func testNotFound(t *testing.T, s service.Store) {
+	ctx := context.Background()
+	created, err := s.Create(ctx, model.Task{Type: "fetch_url"})
+	require.NoError(t, err)
+	missing := created.ID + 100
+
+	_, err = s.GetByID(ctx, missing)
+	assert.ErrorIs(t, err, store.ErrTaskNotFound)
+	_, err = s.GetByIdempotencyKey(ctx, "missing")
+	assert.ErrorIs(t, err, store.ErrTaskNotFound)
+	assert.ErrorIs(t, s.Update(ctx, model.Task{ID: missing, State: model.CompletedState}), store.ErrTaskNotFound)
+	assert.ErrorIs(t, s.ExtendLease(ctx, missing, 1, time.Minute), store.ErrLeaseLost)
+	assert.ErrorIs(t, s.SaveAttempt(ctx, model.Task{ID: missing, State: model.CompletedState}, 1), store.ErrLeaseLost)
+	_, err = s.Cancel(ctx, missing, time.Now())
+	assert.ErrorIs(t, err, store.ErrTaskNotFound)
+
+	// A failed update must not create the task
+	_, err = s.GetByID(ctx, missing)
+	assert.ErrorIs(t, err, store.ErrTaskNotFound)
+}
+
+func testCreateAndGet(t *testing.T, s service.Store) {
+	ctx := context.Background()
+	deadline := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	before := time.Now().Add(-time.Second)
+
+	created, err := s.Create(ctx, model.Task{
+		Type:        "fetch_url",
+		Payload:     json.RawMessage(`{"url":"http://example.com"}`),
+		RetryPolicy: model.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, Multiplier: 2, Jitter: 0.5},
+		Timeout:     time.Minute,
+		Deadline:    &deadline,
+		CallbackURL: "http://example.com/callback",
+		Priority:    5,
+	})
+	require.NoError(t, err)
+	assert.Positive(t, created.ID)
+	assert.Equal(t, model.PendingState, created.State)
+	assert.True(t, created.CreatedAt.After(before))
+
+	task, err := s.GetByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, task.ID)
+	assert.Equal(t, "fetch_url", task.Type)
+	assert.Equal(t, model.PendingState, task.State)
+	assert.JSONEq(t, `{"url":"http://example.com"}`, string(task.Payload))
+	assert.Equal(t, model.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, Multiplier: 2, Jitter: 0.5}, task.RetryPolicy)
+	assert.Equal(t, time.Minute, task.Timeout)
+	require.NotNil(t, task.Deadline)
+	assert.True(t, deadline.Equal(*task.Deadline))
+	assert.Equal(t, "http://example.com/callback", task.CallbackURL)
+	assert.Equal(t, 5, task.Priority)
+	assert.Zero(t, task.Attempts)
+	assert.Nil(t, task.Result)
+	assert.Nil(t, task.ProcessStartedAt)
+	assert.Nil(t, task.ParentID)
+	assert.Empty(t, task.DependsOn)
+}
+
+func testIdempotencyKey(t *testing.T, s service.Store) {
+	ctx := context.Background()
+	first, err := s.Create(ctx, model.Task{Type: "fetch_url", IdempotencyKey: "key", RequestHash: "hash"})
+	require.NoError(t, err)
+
+	second, err := s.Create(ctx, model.Task{Type: "resize_image", IdempotencyKey: "key", RequestHash: "other"})
+	assert.ErrorIs(t, err, store.ErrDuplicateKey)
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, "fetch_url", second.Type)
+	assert.Equal(t, "hash", second.RequestHash)
+
+	found, err := s.GetByIdempotencyKey(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, found.ID)
+
+	// Tasks without a key never conflict
+	for range 2 {
+		_, err := s.Create(ctx, model.Task{Type: "fetch_url"})
+		assert.NoError(t, err)
+	}
+	count, err := s.CountByState(ctx, model.PendingState)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
+
+func testCreateBatch(t *testing.T, s service.Store) {
+	ctx := context.Background()
+	created, err := s.CreateBatch(ctx, []model.Task{
+		{Type: "fetch_url", Priority: 1},
+		{Type: "resize_image", Priority: 2},
+		{Type: "fetch_url", Priority: 3},
+	})
+	require.NoError(t, err)
+	ids := taskIDs(created)
+	require.Len(t, ids, 3)
+	assert.Less(t, ids[0], ids[1])
+	assert.Less(t, ids[1], ids[2])
+
+	for i, id := range ids {
+		task, err := s.GetByID(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, model.PendingState, task.State)
+		assert.Equal(t, i+1, task.Priority)
+		// Returned tasks are the stored ones, with the defaults filled in by the store
+		assert.Equal(t, task.State, created[i].State)
+		assert.Equal(t, task.Priority, created[i].Priority)
+		assert.Equal(t, task.CreatedAt.UnixMicro(), created[i].CreatedAt.UnixMicro())
+	}
+}
+
+func testGetAllOrder(t *testing.T, s service.Store) {
+	ctx := context.Background()
+	created, err := s.CreateBatch(ctx, make([]model.Task, 5))
+	require.NoError(t, err)
+	ids := taskIDs(created)
+
+	tasks, err := s.GetAll(ctx, model.TaskFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, ids, taskIDs(tasks))
+
+	tasks, err = s.GetAll(ctx, model.TaskFilter{Descending: true, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{ids[4], ids[3]}, taskIDs(tasks))
+
+	tasks, err = s.GetAll(ctx, model.TaskFilter{AfterID: ids[1], Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{ids[2], ids[3]}, taskIDs(tasks))
+
+	tasks, err = s.GetAll(ctx, model.TaskFilter{AfterID: ids[1], Descending: true})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{ids[0]}, taskIDs(tasks))
+}
+
+func testGetAllFilter(t *testing.T, s service.Store) {
+	ctx := context.Background()
+	parent, err := s.Create(ctx, model.Task{Type: "split"})
+	require.NoError(t, err)
+	runAt := time.Now().Add(time.Hour)
+	scheduled, err := s.Create(ctx, model.Task{Type: "fetch_url", State: model.ScheduledState, RunAt: &runAt})
+	require.NoError(t, err)
+	created, err := s.CreateBatch(ctx, []model.Task{
+		{Type: "part", ParentID: &parent.ID},
+		{Type: "part", ParentID: &parent.ID},
+	})
+	require.NoError(t, err)
+	children := taskIDs(created)
+
+	tasks, err := s.GetAll(ctx, model.TaskFilter{States: []model.TaskState{model.ScheduledState}})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{scheduled.ID}, taskIDs(tasks))
+
+	tasks, err = s.GetAll(ctx, model.TaskFilter{
+		States: []model.TaskState{model.PendingState, model.ScheduledState},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{parent.ID, scheduled.ID, children[0], children[1]}, taskIDs(tasks))
+
+	tasks, err = s.GetAll(ctx, model.TaskFilter{ParentID: &parent.ID})
+	require.NoError(t, err)
+	assert.Equal(t, children, taskIDs(tasks))
+	for _, task := range tasks {
+		require.NotNil(t, task.ParentID)
+		assert.Equal(t, parent.ID, *task.ParentID)
+	}
+
+	after := time.Now().Add(time.Minute)
+	tasks, err = s.GetAll(ctx, model.TaskFilter{CreatedAfter: &after})
+	require.NoError(t, err)
+	assert.Empty(t, tasks)
+	tasks, err = s.GetAll(ctx, model.TaskFilter{CreatedBefore: &after})
+	require.NoError(t, err)
+	assert.Len(t, tasks, 4)
+}
+
+func testUpdate(t *testing.T, s service.Store) {
+	ctx := context.Background()
+	created, err := s.Create(ctx, model.Task{Type: "fetch_url"})
+	require.NoError(t, err)
+
+	task, err := s.GetByID(ctx, created.ID)
+	require.NoError(t, err)
+	started := time.Now().Add(-time.Second).Truncate(time.Microsecond)
+	ended := time.Now().Truncate(time.Microsecond)
+	task.State = model.FailedState
+	task.ProcessStartedAt = &started
+	task.ProcessEndedAt = &ended
+	task.Attempts = 2
+	task.Result = json.RawMessage(`{"partial":true}`)
+	task.Error = "boom"
+	task.ErrorCode = model.LeaseExpiredErrorCode
+	require.NoError(t, s.Update(ctx, task))
+
+	updated, err := s.GetByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.FailedState, updated.State)
+	require.NotNil(t, updated.ProcessStartedAt)
+	assert.True(t, started.Equal(*updated.ProcessStartedAt))
+	require.NotNil(t, updated.ProcessEndedAt)
+	assert.True(t, ended.Equal(*updated.ProcessEndedAt))
+	assert.Equal(t, 2, updated.Attempts)
+	assert.JSONEq(t, `{"partial":true}`, string(updated.Result))
+	assert.Equal(t, "boom", updated.Error)
+	assert.Equal(t, model.LeaseExpiredErrorCode, updated.ErrorCode)
+}
+
+func testClaimOrder(t *testing.T, s service.Store) {
+	ctx := context.Background()
+	created, err := s.CreateBatch(ctx, []model.Task{
+		{Type: "fetch_url"},
+		{Type: "fetch_url", Priority: 10},
+		{Type: "resize_image", Priority: 20},
+		{Type: "fetch_url", Priority: 10},
+	})
+	require.NoError(t, err)
+	ids := taskIDs(created)
+
+	var claimed []int64
+	for {
+		task, err := s.Claim(ctx, time.Minute, []string{"fetch_url"}, 0)
+		if errors.Is(err, store.ErrNoPendingTasks) {
+			break
+		}
+		require.NoError(t, err)
+		assert.Equal(t, model.ProcessingState, task.State)
+		assert.Equal(t, 1, task.Attempts)
+		assert.NotNil(t, task.ProcessStartedAt)
+		require.NotNil(t, task.LeaseExpiresAt)
+		assert.True(t, task.LeaseExpiresAt.After(time.Now()))
+		claimed = append(claimed, task.ID)
+	}
+	// Higher priority goes first, ties go to the oldest task, other types are left alone
+	assert.Equal(t, []int64{ids[1], ids[3], ids[0]}, claimed)
+
+	count, err := s.CountByState(ctx, model.ProcessingState)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	count, err = s.CountByState(ctx, model.PendingState)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func testClaimRetrying(t *testing.T, s service.Store) {
+	ctx := context.Background()
+	created, err := s.CreateBatch(ctx, []model.Task{{Type: "fetch_url"}, {Type: "fetch_url"}})
+	require.NoError(t, err)
+	ids := taskIDs(created)
+
+	due := time.Now().Add(-time.Second)
+	later := time.Now().Add(time.Hour)
+	for id, nextRunAt := range map[int64]time.Time{ids[0]: later, ids[1]: due} {
+		task, err := s.GetByID(ctx, id)
+		require.NoError(t, err)
+		task.State = model.RetryingState
+		task.Attempts = 1
+		task.NextRunAt = &nextRunAt
+		require.NoError(t, s.Update(ctx, task))
+	}
+
+	task, err := s.Claim(ctx, time.Minute, []string{"fetch_url"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, ids[1], task.ID)
+	assert.Equal(t, 2, task.Attempts)
+	assert.Nil(t, task.NextRunAt)
+
+	_, err = s.Claim(ctx, time.Minute, []string{"fetch_url"}, 0)
+	assert.ErrorIs(t, err, store.ErrNoPendingTasks)
+}
+
+func testConcurrentCreate(t *testing.T, s service.Store) {
+	const workers, perWorker = 8, 20
+	ids := make(chan int64, workers*perWorker)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perWorker {
+				task, err := s.Create(context.Background(), model.Task{Type: "fetch_url"})
+				if assert.NoError(t, err) {
+					ids <- task.ID
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[int64]bool)
+	for id := range ids {
+		assert.False(t, seen[id], "duplicate ID %d", id)
+		seen[id] = true
+	}
+	assert.Len(t, seen, workers*perWorker)
+	count, err := s.CountByState(context.Background(), model.PendingState)
+	require.NoError(t, err)
+	assert.Equal(t, workers*perWorker, count)
+}
+
+func testConcurrentClaim(t *testing.T, s service.Store) {
+	const tasks = 50
+	batch := make([]model.Task, tasks)
+	for i := range batch {
+		batch[i].Type = "fetch_url"
+	}
+	_, err := s.CreateBatch(context.Background(), batch)
+	require.NoError(t, err)
+
+	claimed := make(chan int64, tasks)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				task, err := s.Claim(context.Background(), time.Minute, []string{"fetch_url"}, 0)
+				if errors.Is(err, store.ErrNoPendingTasks) || !assert.NoError(t, err) {
+					return
+				}
+				claimed <- task.ID
+			}
+		}()
+	}
+	wg.Wait()
+	close(claimed)
+
+	seen := make(map[int64]bool)
+	for id := range claimed {
+		assert.False(t, seen[id], "task %d claimed twice", id)
+		seen[id] = true
+	}
+	assert.Len(t, seen, tasks)
+}
+
+func testLease(t *testing.T, s service.Store) {
+	ctx := context.Background()
+	created, err := s.Create(ctx, model.Task{Type: "fetch_url"})
+	require.NoError(t, err)
+
+	// Only processing tasks are leased
+	assert.ErrorIs(t, s.ExtendLease(ctx, created.ID, 0, time.Minute), store.ErrLeaseLost)
+
+	claimed, err := s.Claim(ctx, time.Minute, []string{"fetch_url"}, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.ExtendLease(ctx, claimed.ID, claimed.Attempts, time.Hour))
+
+	task, err := s.GetByID(ctx, claimed.ID)
+	require.NoError(t, err)
+	require.NotNil(t, task.LeaseExpiresAt)
+	assert.True(t, task.LeaseExpiresAt.After(time.Now().Add(30*time.Minute)))
+}
+
+func testLeaseFencing(t *testing.T, s service.Store) {
+	ctx := context.Background()
+	_, err := s.Create(ctx, model.Task{Type: "fetch_url", RetryPolicy: model.RetryPolicy{MaxAttempts: 3}})
+	require.NoError(t, err)
+	stale, err := s.Claim(ctx, time.Minute, []string{"fetch_url"}, 0)
+	require.NoError(t, err)
+
+	// The lease expires while the first attempt is still running, the task is requeued and claimed again
+	_, err = s.ReleaseExpired(ctx, time.Now().Add(2*time.Minute), model.PendingState)
+	require.NoError(t, err)
+	current, err := s.Claim(ctx, time.Minute, []string{"fetch_url"}, 0)
+	require.NoError(t, err)
+	require.Equal(t, stale.ID, current.ID)
+	require.Equal(t, stale.Attempts+1, current.Attempts)
+
+	assert.ErrorIs(t, s.ExtendLease(ctx, stale.ID, stale.Attempts, time.Hour), store.ErrLeaseLost)
+	done := stale
+	done.State = model.CompletedState
+	done.Result = json.RawMessage(`"stale"`)
+	assert.ErrorIs(t, s.SaveAttempt(ctx, done, stale.Attempts), store.ErrLeaseLost)
+
+	require.NoError(t, s.ExtendLease(ctx, current.ID, current.Attempts, time.Hour))
+	done = current
+	done.State = model.CompletedState
+	done.Result = json.RawMessage(`"current"`)
+	require.NoError(t, s.SaveAttempt(ctx, done, current.Attempts))
+
+	task, err := s.GetByID(ctx, current.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.CompletedState, task.State)
+	assert.JSONEq(t, `"current"`, string(task.Result))
+
+	// A finished task is not held by any attempt
+	assert.ErrorIs(t, s.SaveAttempt(ctx, done, current.Attempts), store.ErrLeaseLost)
+}
+
+func testReleaseExpired(t *testing.T, s service.Store) {
+	ctx := context.Background()
+	_, err := s.CreateBatch(ctx, []model.Task{{Type: "fetch_url"}, {Type: "resize_image"}})
+	require.NoError(t, err)
+	requeued, err := s.Claim(ctx, time.Minute, []string{"fetch_url"}, 0)
+	require.NoError(t, err)
+
+	released, err := s.ReleaseExpired(ctx, time.Now(), model.PendingState)
+	require.NoError(t, err)
+	assert.Empty(t, released, "the lease has not expired yet")
+
+	released, err = s.ReleaseExpired(ctx, time.Now().Add(2*time.Minute), model.PendingState)
+	require.NoError(t, err)
+	require.Equal(t, []int64{requeued.ID}, taskIDs(released))
+	assert.Equal(t, model.PendingState, released[0].State)
+	task, err := s.GetByID(ctx, requeued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.PendingState, task.State)
+	assert.Nil(t, task.LeaseExpiresAt)
+	assert.Nil(t, task.ProcessStartedAt)
+	assert.Equal(t, model.LeaseExpiredErrorCode, task.ErrorCode)
+
+	failed, err := s.Claim(ctx, time.Minute, []string{"resize_image"}, 0)
+	require.NoError(t, err)
+	now := time.Now().Add(2 * time.Minute)
+	released, err = s.ReleaseExpired(ctx, now, model.FailedState)
+	require.NoError(t, err)
+	require.Equal(t, []int64{failed.ID}, taskIDs(released))
+	assert.Equal(t, model.FailedState, released[0].State)
+	assert.Equal(t, model.LeaseExpiredErrorCode, released[0].ErrorCode)
+	task, err = s.GetByID(ctx, failed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.FailedState, task.State)
+	assert.Nil(t, task.LeaseExpiresAt)
+	require.NotNil(t, task.ProcessEndedAt)
+	assert.WithinDuration(t, now, *task.ProcessEndedAt, time.Millisecond)
+	assert.Equal(t, store.ErrLeaseExpired.Error(), task.Error)
+}
+
+func testCancel(t *testing.T, s service.Store) {
+	ctx := context.Background()
+	runAt := time.Now().Add(time.Hour)
+	created := make([]model.Task, 0, 3)
+	for _, task := range []model.Task{
+		{Type: "fetch_url", State: model.ScheduledState, RunAt: &runAt},
+		{Type: "fetch_url"},
+		{Type: "resize_image"},
+	} {
+		task, err := s.Create(ctx, task)
+		require.NoError(t, err)
+		created = append(created, task)
+	}
+	_, err := s.Claim(ctx, time.Minute, []string{"resize_image"}, 0)
+	require.NoError(t, err)
+
+	now := time.Now()
+	for _, task := range created {
+		cancelled, err := s.Cancel(ctx, task.ID, now)
+		require.NoError(t, err)
+		assert.Equal(t, model.CancelledState, cancelled.State)
+		assert.Nil(t, cancelled.LeaseExpiresAt)
+		require.NotNil(t, cancelled.ProcessEndedAt)
+
+		_, err = s.Cancel(ctx, task.ID, now)
+		assert.ErrorIs(t, err, store.ErrTaskFinished)
+	}
+
+	count, err := s.CountByState(ctx, model.CancelledState)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	_, err = s.Claim(ctx, time.Minute, []string{"fetch_url", "resize_image"}, 0)
+	assert.ErrorIs(t, err, store.ErrNoPendingTasks)
+}
+
+func testCancelProcessing(t *testing.T, s service.Store) {
+	ctx := context.Background()
+	_, err := s.Create(ctx, model.Task{Type: "fetch_url"})
+	require.NoError(t, err)
+	claimed, err := s.Claim(ctx, time.Minute, []string{"fetch_url"}, 0)
+	require.NoError(t, err)
+
+	_, err = s.Cancel(ctx, claimed.ID, time.Now())
+	require.NoError(t, err)
+
+	// The handler returns after the task was cancelled, its outcome must not overwrite the cancellation
+	done := claimed
+	done.State = model.CompletedState
+	done.Result = json.RawMessage(`{}`)
+	assert.ErrorIs(t, s.SaveAttempt(ctx, done, claimed.Attempts), store.ErrLeaseLost)
+	assert.ErrorIs(t, s.ExtendLease(ctx, claimed.ID, claimed.Attempts, time.Minute), store.ErrLeaseLost)
+
+	task, err := s.GetByID(ctx, claimed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.CancelledState, task.State)
+	assert.Nil(t, task.Result)
+}
+
+func testPromoteDue(t *testing.T, s service.Store) {
+	ctx := context.Background()
+	now := time.Now()
+	soon, later := now.Add(time.Minute), now.Add(time.Hour)
+	created, err := s.CreateBatch(ctx, []model.Task{
+		{Type: "fetch_url", State: model.ScheduledState, RunAt: &later},
+		{Type: "fetch_url", State: model.ScheduledState, RunAt: &soon},
+		{Type: "fetch_url"},
+	})
+	require.NoError(t, err)
+	ids := taskIDs(created)
+
+	promoted, err := s.PromoteDue(ctx, now)
+	require.NoError(t, err)
+	assert.Empty(t, promoted)
+
+	promoted, err = s.PromoteDue(ctx, soon)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{ids[1]}, taskIDs(promoted))
+	assert.Equal(t, model.PendingState, promoted[0].State)
+
+	promoted, err = s.PromoteDue(ctx, later.Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, []int64{ids[0]}, taskIDs(promoted))
+}
+
+func testResolveDependencies(t *testing.T, s service.Store) {
+	ctx := context.Background()
+	runAt := time.Now().Add(time.Hour)
+	created, err := s.CreateWorkflow(ctx, []model.Task{
+		{Type: "fetch_url"},
+		{Type: "fetch_url"},
+		{Type: "fetch_url"},
+		{Type: "fetch_url", RunAt: &runAt},
+		{Type: "fetch_url"},
+	}, [][]int{nil, nil, {0, 1}, {0}, {1}})
+	require.NoError(t, err)
+	ids := taskIDs(created)
+
+	task, err := s.GetByID(ctx, ids[2])
+	require.NoError(t, err)
+	assert.Equal(t, model.WaitingState, task.State)
+	assert.ElementsMatch(t, []int64{ids[0], ids[1]}, task.DependsOn)
+	assert.Equal(t, model.WaitingState, created[2].State)
+	assert.ElementsMatch(t, []int64{ids[0], ids[1]}, created[2].DependsOn)
+
+	resolved, err := s.ResolveDependencies(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, resolved)
+
+	finish(t, s, ids[0], model.CompletedState)
+	resolved, err = s.ResolveDependencies(ctx, time.Now())
+	require.NoError(t, err)
+	// The third task still waits for the second one, the fourth one waits for its run time
+	require.Equal(t, []int64{ids[3]}, taskIDs(resolved))
+	assert.Equal(t, model.ScheduledState, resolved[0].State)
+
+	finish(t, s, ids[1], model.FailedState)
+	resolved, err = s.ResolveDependencies(ctx, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, []int64{ids[2], ids[4]}, taskIDs(resolved))
+	for _, task := range resolved {
+		assert.Equal(t, model.FailedState, task.State)
+		assert.Equal(t, model.DependencyFailedErrorCode, task.ErrorCode)
+		assert.NotNil(t, task.ProcessEndedAt)
+	}
+
+	// A task depending on a task outside the workflow starts once it completes
+	dependent, err := s.Create(ctx, model.Task{Type: "fetch_url", DependsOn: []int64{ids[0]}})
+	require.NoError(t, err)
+	assert.Equal(t, model.WaitingState, dependent.State)
+	resolved, err = s.ResolveDependencies(ctx, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, []int64{dependent.ID}, taskIDs(resolved))
+	assert.Equal(t, model.PendingState, resolved[0].State)
+}
+
+func testCompleteParents(t *testing.T, s service.Store) {
+	ctx := context.Background()
+	parent, err := s.Create(ctx, model.Task{Type: "split"})
+	require.NoError(t, err)
+	created, err := s.CreateBatch(ctx, []model.Task{
+		{Type: "part", ParentID: &parent.ID},
+		{Type: "part", ParentID: &parent.ID},
+	})
+	require.NoError(t, err)
+	children := taskIDs(created)
+
+	task, err := s.GetByID(ctx, parent.ID)
+	require.NoError(t, err)
+	task.State = model.AwaitingChildrenState
+	task.Result = json.RawMessage(`{"parts":2}`)
+	require.NoError(t, s.Update(ctx, task))
+
+	child, err := s.GetByID(ctx, children[0])
+	require.NoError(t, err)
+	child.State = model.CompletedState
+	child.Result = json.RawMessage(`1`)
+	require.NoError(t, s.Update(ctx, child))
+
+	completed, err := s.CompleteParents(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, completed, "the second child is still pending")
+
+	_, err = s.Cancel(ctx, children[1], time.Now())
+	require.NoError(t, err)
+	completed, err = s.CompleteParents(ctx, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, []int64{parent.ID}, taskIDs(completed))
+	assert.Equal(t, model.CompletedState, completed[0].State)
+	assert.NotNil(t, completed[0].ProcessEndedAt)
+
+	var result struct {
+		Result   json.RawMessage `json:"result"`
+		Children []struct {
+			ID     int64           `json:"id"`
+			State  model.TaskState `json:"state"`
+			Result json.RawMessage `json:"result"`
+		} `json:"children"`
+	}
+	require.NoError(t, json.Unmarshal(completed[0].Result, &result))
+	assert.JSONEq(t, `{"parts":2}`, string(result.Result))
+	require.Len(t, result.Children, 2)
+	assert.Equal(t, children[0], result.Children[0].ID)
+	assert.Equal(t, model.CompletedState, result.Children[0].State)
+	assert.JSONEq(t, `1`, string(result.Children[0].Result))
+	assert.Equal(t, children[1], result.Children[1].ID)
+	assert.Equal(t, model.CancelledState, result.Children[1].State)
+
+	completed, err = s.CompleteParents(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, completed)
+}
+
+// finish moves the task with taskID to a finished state as if it was processed
+func finish(t *testing.T, s service.Store, taskID int64, state model.TaskState) {
+	t.Helper()
+
+	task, err := s.GetByID(context.Background(), taskID)
+	require.NoError(t, err)
+	ended := time.Now()
+	task.State = state
+	task.ProcessEndedAt = &ended
+	require.NoError(t, s.Update(context.Background(), task))
+}
+
+func taskIDs(tasks []model.Task) []int64 {
+	ids := make([]int64, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	return ids
+}
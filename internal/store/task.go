@@ -1,9 +1,12 @@
 package store
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
 	"io-load-api/internal/model"
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 )
@@ -14,31 +17,40 @@ type TaskStore struct {
 	mu     sync.RWMutex
 	store  map[int64]*model.Task
 	nextID int64
+	// keys maps idempotency keys to IDs of the tasks created with them
+	keys map[string]int64
 }
 
-//const start int64 = 0
+const start int64 = 0
 
-//func NewTaskStore(logger *slog.Logger) *TaskStore {
-//	return &TaskStore{
-//		store:  make(map[int64]*model.Task),
-//		nextID: start,
-//		log:    logger,
-//	}
-//}
+// NewTaskStore returns an empty store. Tasks are lost when the process exits, so it suits a single instance
+// and tests which run without a database
+func NewTaskStore(logger *slog.Logger) *TaskStore {
+	return &TaskStore{
+		store:  make(map[int64]*model.Task),
+		nextID: start,
+		keys:   make(map[string]int64),
+		log:    logger,
+	}
+}
 
-func (s *TaskStore) Create(context.Context) (model.Task, error) {
+// Create stores task as a new pending task with the next ID. A task in the scheduled state stays scheduled.
+// If another task has the same idempotency key, it returns that task and ErrDuplicateKey
+func (s *TaskStore) Create(_ context.Context, task model.Task) (model.Task, error) {
 	const op = "store.Create"
 	log := s.log.With(slog.String("op", op))
 
-	s.nextID++
-	task := model.Task{
-		ID:        s.nextID,
-		State:     model.PendingState,
-		CreatedAt: time.Now(),
-	}
 	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.findByIdempotencyKey(task.IdempotencyKey); ok {
+		return existing, ErrDuplicateKey
+	}
+	s.nextID++
+	task.ID = s.nextID
+	task.State = InitialState(task)
+	task.CreatedAt = time.Now()
 	s.store[task.ID] = &task
-	s.mu.Unlock()
+	s.indexKey(task)
 
 	log.Debug("Created task with ID", slog.Int64("task_id", task.ID))
 	return task, nil
@@ -61,21 +73,124 @@ func (s *TaskStore) GetByID(_ context.Context, taskID int64) (model.Task, error)
 	return *task, nil
 }
 
-func (s *TaskStore) GetAll(context.Context) ([]model.Task, error) {
+// CreateBatch stores tasks as new pending tasks with consecutive IDs and returns the stored tasks in the order
+// of tasks
+func (s *TaskStore) CreateBatch(ctx context.Context, tasks []model.Task) ([]model.Task, error) {
+	return s.CreateWorkflow(ctx, tasks, nil)
+}
+
+// CreateWorkflow stores tasks like CreateBatch. Task i also depends on tasks whose indexes are listed
+// in dependencies[i], in addition to its own DependsOn
+func (s *TaskStore) CreateWorkflow(_ context.Context, tasks []model.Task, dependencies [][]int) ([]model.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	createdAt := time.Now()
+	ids := make([]int64, len(tasks))
+	for i := range tasks {
+		s.nextID++
+		ids[i] = s.nextID
+	}
+	created := make([]model.Task, len(tasks))
+	for i, task := range tasks {
+		task.ID = ids[i]
+		if i < len(dependencies) {
+			task.DependsOn = slices.Clone(task.DependsOn)
+			for _, parent := range dependencies[i] {
+				task.DependsOn = append(task.DependsOn, ids[parent])
+			}
+		}
+		task.State = InitialState(task)
+		task.CreatedAt = createdAt
+		s.store[task.ID] = &task
+		s.indexKey(task)
+		created[i] = task
+	}
+	return created, nil
+}
+
+// GetByIdempotencyKey returns the task created with key or ErrTaskNotFound
+func (s *TaskStore) GetByIdempotencyKey(_ context.Context, key string) (model.Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	task, ok := s.findByIdempotencyKey(key)
+	if !ok {
+		return model.Task{}, ErrTaskNotFound
+	}
+	return task, nil
+}
+
+func (s *TaskStore) findByIdempotencyKey(key string) (model.Task, bool) {
+	if key == "" {
+		return model.Task{}, false
+	}
+	id, ok := s.keys[key]
+	if !ok {
+		return model.Task{}, false
+	}
+	return *s.store[id], true
+}
+
+// indexKey makes a newly created task findable by its idempotency key. The first task created with a key keeps it
+func (s *TaskStore) indexKey(task model.Task) {
+	if task.IdempotencyKey == "" {
+		return
+	}
+	if _, ok := s.keys[task.IdempotencyKey]; !ok {
+		s.keys[task.IdempotencyKey] = task.ID
+	}
+}
+
+// GetAll returns tasks matching filter
+func (s *TaskStore) GetAll(_ context.Context, filter model.TaskFilter) ([]model.Task, error) {
 	const op = "store.GetAllTasks"
 	log := s.log.With(slog.String("op", op))
 
-	log.Debug("Getting all tasks")
-	tasks := make([]model.Task, 0, len(s.store))
+	log.Debug("Getting tasks")
 	s.mu.RLock()
+	tasks := make([]model.Task, 0, len(s.store))
 	for _, task := range s.store {
-		tasks = append(tasks, *task)
+		if matches(*task, filter) {
+			tasks = append(tasks, *task)
+		}
 	}
 	s.mu.RUnlock()
+
+	slices.SortFunc(tasks, func(a, b model.Task) int {
+		if filter.Descending {
+			return cmp.Compare(b.ID, a.ID)
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	if filter.Limit > 0 && len(tasks) > filter.Limit {
+		tasks = tasks[:filter.Limit]
+	}
 	log.Debug("Tasks found", slog.Int("tasks_count", len(tasks)))
 	return tasks, nil
 }
 
+func matches(task model.Task, filter model.TaskFilter) bool {
+	if len(filter.States) > 0 && !slices.Contains(filter.States, task.State) {
+		return false
+	}
+	if filter.ParentID != nil && (task.ParentID == nil || *task.ParentID != *filter.ParentID) {
+		return false
+	}
+	if filter.CreatedAfter != nil && task.CreatedAt.Before(*filter.CreatedAfter) {
+		return false
+	}
+	if filter.CreatedBefore != nil && !task.CreatedAt.Before(*filter.CreatedBefore) {
+		return false
+	}
+	if filter.AfterID > 0 {
+		if filter.Descending && task.ID >= filter.AfterID || !filter.Descending && task.ID <= filter.AfterID {
+			return false
+		}
+	}
+	return true
+}
+
 func (s *TaskStore) Update(_ context.Context, task model.Task) error {
 	const op = "store.UpdateTask"
 	log := s.log.With(slog.String("op", op))
@@ -92,3 +207,322 @@ func (s *TaskStore) Update(_ context.Context, task model.Task) error {
 		return ErrTaskNotFound
 	}
 }
+
+// Claim moves the pending or due retrying task of one of types with the highest priority to processing state,
+// counts the attempt, leases the task for lease duration and returns it. A task gains one priority level
+// for every aging interval it has been waiting since it became due, ties go to the oldest task
+func (s *TaskStore) Claim(
+	_ context.Context,
+	lease time.Duration,
+	types []string,
+	aging time.Duration,
+) (model.Task, error) {
+	const op = "store.Claim"
+	log := s.log.With(slog.String("op", op))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	startTime := time.Now()
+	var (
+		claimed         *model.Task
+		claimedPriority int64
+	)
+	for _, task := range s.store {
+		due := task.State == model.PendingState ||
+			task.State == model.RetryingState && task.NextRunAt != nil && !task.NextRunAt.After(startTime)
+		if !due || !slices.Contains(types, task.Type) {
+			continue
+		}
+		priority := effectivePriority(*task, startTime, aging)
+		if claimed == nil || priority > claimedPriority || priority == claimedPriority && task.ID < claimed.ID {
+			claimed, claimedPriority = task, priority
+		}
+	}
+	if claimed == nil {
+		return model.Task{}, ErrNoPendingTasks
+	}
+
+	leaseExpiresAt := startTime.Add(lease)
+	task := *claimed
+	task.State = model.ProcessingState
+	task.ProcessStartedAt = &startTime
+	task.LeaseExpiresAt = &leaseExpiresAt
+	task.Attempts++
+	task.NextRunAt = nil
+	s.store[task.ID] = &task
+
+	log.Debug("Claimed task", slog.Int64("task_id", task.ID))
+	return task, nil
+}
+
+// effectivePriority is the priority of a due task raised by one for every aging interval it has been waiting
+func effectivePriority(task model.Task, now time.Time, aging time.Duration) int64 {
+	priority := int64(task.Priority)
+	if aging <= 0 {
+		return priority
+	}
+	waitingSince := task.CreatedAt
+	if task.NextRunAt != nil {
+		waitingSince = *task.NextRunAt
+	} else if task.RunAt != nil {
+		waitingSince = *task.RunAt
+	}
+	if waited := now.Sub(waitingSince); waited > 0 {
+		priority += int64(waited / aging)
+	}
+	return priority
+}
+
+// PromoteDue moves scheduled tasks whose run time is not after now to pending state and returns them
+func (s *TaskStore) PromoteDue(_ context.Context, now time.Time) ([]model.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var promoted []model.Task
+	for id, task := range s.store {
+		if task.State != model.ScheduledState || task.RunAt != nil && task.RunAt.After(now) {
+			continue
+		}
+		due := *task
+		due.State = model.PendingState
+		s.store[id] = &due
+		promoted = append(promoted, due)
+	}
+	slices.SortFunc(promoted, func(a, b model.Task) int { return cmp.Compare(a.ID, b.ID) })
+	return promoted, nil
+}
+
+// InitialState is the state a new task is stored in: tasks with dependencies wait for them,
+// scheduled tasks wait for their run time, others are pending
+func InitialState(task model.Task) model.TaskState {
+	switch {
+	case len(task.DependsOn) > 0 || task.State == model.WaitingState:
+		return model.WaitingState
+	case task.State == model.ScheduledState:
+		return model.ScheduledState
+	}
+	return model.PendingState
+}
+
+// ReleasedState is the state a waiting task moves to once its dependencies have completed
+func ReleasedState(task model.Task, now time.Time) model.TaskState {
+	if task.RunAt != nil && task.RunAt.After(now) {
+		return model.ScheduledState
+	}
+	return model.PendingState
+}
+
+// ResolveDependencies moves waiting tasks whose dependencies have all completed to pending or scheduled state
+// and fails waiting tasks with a dependency which finished without completing. It returns the changed tasks
+func (s *TaskStore) ResolveDependencies(_ context.Context, now time.Time) ([]model.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changed []model.Task
+	for id, task := range s.store {
+		if task.State != model.WaitingState {
+			continue
+		}
+		ready, broken := true, false
+		for _, parentID := range task.DependsOn {
+			parent, ok := s.store[parentID]
+			switch {
+			case !ok || parent.State.Finished() && parent.State != model.CompletedState:
+				broken = true
+			case parent.State != model.CompletedState:
+				ready = false
+			}
+		}
+		if !ready && !broken {
+			continue
+		}
+
+		resolved := *task
+		if broken {
+			endTime := now
+			resolved.State = model.FailedState
+			resolved.ProcessEndedAt = &endTime
+			resolved.Error = ErrDependencyFailed.Error()
+			resolved.ErrorCode = model.DependencyFailedErrorCode
+		} else {
+			resolved.State = ReleasedState(resolved, now)
+		}
+		s.store[id] = &resolved
+		changed = append(changed, resolved)
+	}
+	slices.SortFunc(changed, func(a, b model.Task) int { return cmp.Compare(a.ID, b.ID) })
+	return changed, nil
+}
+
+// childResult is the outcome of a child in the aggregated result of its parent
+type childResult struct {
+	ID        int64           `json:"id"`
+	State     model.TaskState `json:"state"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	ErrorCode string          `json:"error_code,omitempty"`
+}
+
+// ParentResult aggregates the own result of a parent and the outcomes of its children into the result
+// the parent completes with. Children are listed in the order of their IDs
+func ParentResult(result json.RawMessage, children []model.Task) (json.RawMessage, error) {
+	outcomes := make([]childResult, len(children))
+	for i, child := range children {
+		outcomes[i] = childResult{
+			ID:        child.ID,
+			State:     child.State,
+			Result:    child.Result,
+			Error:     child.Error,
+			ErrorCode: child.ErrorCode,
+		}
+	}
+	slices.SortFunc(outcomes, func(a, b childResult) int { return cmp.Compare(a.ID, b.ID) })
+	return json.Marshal(struct {
+		Result   json.RawMessage `json:"result,omitempty"`
+		Children []childResult   `json:"children"`
+	}{result, outcomes})
+}
+
+// CompleteParents completes tasks awaiting children whose children have all finished, whatever their outcome.
+// The result of a completed parent aggregates its own result and the results of its children. It returns
+// the completed tasks
+func (s *TaskStore) CompleteParents(_ context.Context, now time.Time) ([]model.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	children := make(map[int64][]model.Task)
+	for _, task := range s.store {
+		if task.ParentID != nil {
+			children[*task.ParentID] = append(children[*task.ParentID], *task)
+		}
+	}
+
+	var completed []model.Task
+	for id, task := range s.store {
+		if task.State != model.AwaitingChildrenState {
+			continue
+		}
+		if slices.ContainsFunc(children[id], func(child model.Task) bool { return !child.State.Finished() }) {
+			continue
+		}
+		result, err := ParentResult(task.Result, children[id])
+		if err != nil {
+			return nil, err
+		}
+
+		endTime := now
+		parent := *task
+		parent.State = model.CompletedState
+		parent.ProcessEndedAt = &endTime
+		parent.Result = result
+		s.store[id] = &parent
+		completed = append(completed, parent)
+	}
+	slices.SortFunc(completed, func(a, b model.Task) int { return cmp.Compare(a.ID, b.ID) })
+	return completed, nil
+}
+
+// ExtendLease prolongs the lease of a task processing attempt. It returns ErrLeaseLost if the task is no longer
+// processing that attempt
+func (s *TaskStore) ExtendLease(_ context.Context, taskID int64, attempt int, lease time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.store[taskID]
+	if !ok || !holds(*task, attempt) {
+		return ErrLeaseLost
+	}
+	leaseExpiresAt := time.Now().Add(lease)
+	extended := *task
+	extended.LeaseExpiresAt = &leaseExpiresAt
+	s.store[taskID] = &extended
+	return nil
+}
+
+// SaveAttempt overwrites the mutable state of a task like Update if the task is still processing attempt.
+// It returns ErrLeaseLost otherwise, e.g. if the task was cancelled or recovered meanwhile
+func (s *TaskStore) SaveAttempt(_ context.Context, task model.Task, attempt int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.store[task.ID]
+	if !ok || !holds(*stored, attempt) {
+		return ErrLeaseLost
+	}
+	s.store[task.ID] = &task
+	return nil
+}
+
+// holds reports whether attempt is processing task
+func holds(task model.Task, attempt int) bool {
+	return task.State == model.ProcessingState && task.Attempts == attempt
+}
+
+// ReleaseExpired moves processing tasks whose lease expired before now to state and returns them
+func (s *TaskStore) ReleaseExpired(_ context.Context, now time.Time, state model.TaskState) ([]model.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var released []model.Task
+	for id, task := range s.store {
+		if task.State != model.ProcessingState || task.LeaseExpiresAt == nil || !task.LeaseExpiresAt.Before(now) {
+			continue
+		}
+		expired := *task
+		expired.State = state
+		expired.LeaseExpiresAt = nil
+		expired.Error = ErrLeaseExpired.Error()
+		expired.ErrorCode = model.LeaseExpiredErrorCode
+		if state == model.PendingState {
+			expired.ProcessStartedAt = nil
+		} else {
+			endTime := now
+			expired.ProcessEndedAt = &endTime
+		}
+		s.store[id] = &expired
+		released = append(released, expired)
+	}
+	slices.SortFunc(released, func(a, b model.Task) int { return cmp.Compare(a.ID, b.ID) })
+	return released, nil
+}
+
+// Cancel moves a scheduled, waiting, pending, retrying, processing or awaiting children task to cancelled state
+// and returns it
+func (s *TaskStore) Cancel(_ context.Context, taskID int64, now time.Time) (model.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.store[taskID]
+	if !ok {
+		return model.Task{}, ErrTaskNotFound
+	}
+	switch stored.State {
+	case model.ScheduledState, model.WaitingState, model.PendingState, model.RetryingState, model.ProcessingState,
+		model.AwaitingChildrenState:
+	default:
+		return model.Task{}, ErrTaskFinished
+	}
+
+	endTime := now
+	task := *stored
+	task.State = model.CancelledState
+	task.ProcessEndedAt = &endTime
+	task.LeaseExpiresAt = nil
+	task.NextRunAt = nil
+	s.store[taskID] = &task
+	return task, nil
+}
+
+func (s *TaskStore) CountByState(_ context.Context, state model.TaskState) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, task := range s.store {
+		if task.State == state {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,89 @@
+package store_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io-load-api/internal/model"
+	"io-load-api/internal/service"
+	"io-load-api/internal/store"
+	"io-load-api/internal/store/storetest"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTaskStore_ConcurrentCreate(t *testing.T) {
+	s := store.NewTaskStore(slog.Default())
+
+	const workers, perWorker = 8, 50
+	ids := make(chan int64, workers*perWorker)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perWorker {
+				task, err := s.Create(context.Background(), model.Task{Type: "fetch_url"})
+				assert.NoError(t, err)
+				ids <- task.ID
+				_, err = s.GetAll(context.Background(), model.TaskFilter{})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[int64]bool)
+	for id := range ids {
+		assert.False(t, seen[id], "duplicate ID %d", id)
+		seen[id] = true
+	}
+	assert.Len(t, seen, workers*perWorker)
+	count, err := s.CountByState(context.Background(), model.PendingState)
+	assert.NoError(t, err)
+	assert.Equal(t, workers*perWorker, count)
+}
+
+func TestTaskStore_ConcurrentClaim(t *testing.T) {
+	s := store.NewTaskStore(slog.Default())
+
+	const tasks = 100
+	for range tasks {
+		_, err := s.Create(context.Background(), model.Task{Type: "fetch_url"})
+		assert.NoError(t, err)
+	}
+
+	claimed := make(chan int64, tasks)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				task, err := s.Claim(context.Background(), time.Minute, []string{"fetch_url"}, time.Minute)
+				if err != nil {
+					assert.ErrorIs(t, err, store.ErrNoPendingTasks)
+					return
+				}
+				claimed <- task.ID
+			}
+		}()
+	}
+	wg.Wait()
+	close(claimed)
+
+	seen := make(map[int64]bool)
+	for id := range claimed {
+		assert.False(t, seen[id], "task %d claimed twice", id)
+		seen[id] = true
+	}
+	assert.Len(t, seen, tasks)
+}
+
+func TestTaskStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(*testing.T) service.Store {
+		return store.NewTaskStore(slog.Default())
+	})
+}
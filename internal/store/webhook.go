@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+	"io-load-api/internal/model"
+	"sync"
+)
+
+// DeliveryStore is in-memory log of webhook deliveries
+type DeliveryStore struct {
+	mu         sync.Mutex
+	deliveries []model.WebhookDelivery
+}
+
+func NewDeliveryStore() *DeliveryStore {
+	return &DeliveryStore{}
+}
+
+// LogDelivery records an attempt to deliver a task webhook
+func (s *DeliveryStore) LogDelivery(_ context.Context, delivery model.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery.ID = int64(len(s.deliveries)) + 1
+	s.deliveries = append(s.deliveries, delivery)
+	return nil
+}
+
+// Deliveries returns attempts to deliver webhooks of the task with taskID in the order they were made
+func (s *DeliveryStore) Deliveries(taskID int64) []model.WebhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deliveries []model.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if delivery.TaskID == taskID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries
+}
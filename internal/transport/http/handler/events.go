@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"io-load-api/internal/broker"
+	"io-load-api/internal/model"
+	"io-load-api/internal/service"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// keepAliveInterval is how often a comment is sent to idle streams so proxies do not close them
+	keepAliveInterval = 15 * time.Second
+
+	defaultWaitTimeout = 30 * time.Second
+	maxWaitTimeout     = 5 * time.Minute
+	// waitPollInterval is how often a waiting request rereads the task in case a change
+	// made by another instance was not delivered to this one
+	waitPollInterval = time.Second
+)
+
+// Subscriber provides task state changes published by the service
+type Subscriber interface {
+	Subscribe(taskID int64) (<-chan model.Task, func())
+}
+
+// TaskEvents streams state changes of a task as Server-Sent Events. The current state is sent first,
+// the stream ends when the task reaches a final state
+func (h *Handler) TaskEvents(c *gin.Context) {
+	taskID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+	// Subscribe before reading the task, so changes made in between are not lost
+	changes, unsubscribe := h.events.Subscribe(taskID)
+	defer unsubscribe()
+
+	task, err := h.taskService.GetTaskByID(c, taskID)
+	if errors.Is(err, service.ErrTaskNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.streamEvents(c, changes, &task)
+}
+
+// AllTaskEvents streams state changes of all tasks as Server-Sent Events until the client disconnects
+func (h *Handler) AllTaskEvents(c *gin.Context) {
+	changes, unsubscribe := h.events.Subscribe(broker.AllTasks)
+	defer unsubscribe()
+
+	h.streamEvents(c, changes, nil)
+}
+
+// streamEvents writes changes to the client. If current is set, it is sent first and the stream
+// ends after a change to a final state
+func (h *Handler) streamEvents(c *gin.Context, changes <-chan model.Task, current *model.Task) {
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	if current != nil {
+		c.SSEvent("state", newTaskResponse(*current))
+		if current.State.Finished() {
+			c.Writer.Flush()
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			return err == nil
+		case task, ok := <-changes:
+			if !ok {
+				return false
+			}
+			c.SSEvent("state", newTaskResponse(task))
+			return current == nil || !task.State.Finished()
+		}
+	})
+}
+
+// WaitTask blocks until the task reaches a final state or the timeout query parameter expires and returns the task.
+// On timeout the task is returned in its current state
+func (h *Handler) WaitTask(c *gin.Context) {
+	taskID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+	timeout := defaultWaitTimeout
+	if value := c.Query("timeout"); value != "" {
+		timeout, err = time.ParseDuration(value)
+		if err != nil || timeout <= 0 || timeout > maxWaitTimeout {
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				gin.H{"error": fmt.Sprintf("timeout must be a positive duration up to %s", maxWaitTimeout)},
+			)
+			return
+		}
+	}
+
+	changes, unsubscribe := h.events.Subscribe(taskID)
+	defer unsubscribe()
+
+	task, err := h.taskService.GetTaskByID(c, taskID)
+	if errors.Is(err, service.ErrTaskNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	poll := time.NewTicker(waitPollInterval)
+	defer poll.Stop()
+
+	for !task.State.Finished() {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-timer.C:
+			c.JSON(http.StatusOK, newTaskResponse(task))
+			return
+		case <-poll.C:
+			if current, err := h.taskService.GetTaskByID(c, taskID); err == nil {
+				task = current
+			}
+		case change, ok := <-changes:
+			if !ok {
+				c.JSON(http.StatusOK, newTaskResponse(task))
+				return
+			}
+			task = change
+		}
+	}
+	c.JSON(http.StatusOK, newTaskResponse(task))
+}
@@ -2,8 +2,12 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"io-load-api/internal/model"
+	"io-load-api/internal/service"
 	"io-load-api/internal/transport/http/middleware"
 	"log/slog"
 	"net/http"
@@ -11,20 +15,33 @@ import (
 	"time"
 )
 
+// IdempotencyKeyHeader makes repeated task creation requests with the same value return the task created first
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+const maxIdempotencyKeyLength = 255
+
 type TaskService interface {
-	CreateTask(ctx context.Context) (int64, error)
+	CreateTask(ctx context.Context, spec model.TaskSpec) (int64, error)
+	CreateTasks(ctx context.Context, specs []model.TaskSpec) ([]int64, error)
 	GetTaskByID(ctx context.Context, id int64) (model.Task, error)
-	GetAllTasks(ctx context.Context) ([]model.Task, error)
+	GetAllTasks(ctx context.Context, query model.TaskQuery) (model.TaskPage, error)
+	CancelTask(ctx context.Context, id int64) (model.Task, error)
+	GetTaskChildren(ctx context.Context, id int64) ([]model.Task, error)
+	CreateWorkflow(ctx context.Context, nodes []model.WorkflowNode) (map[string]int64, error)
 }
 
 type Handler struct {
 	taskService TaskService
+	schedules   ScheduleService
+	events      Subscriber
 	log         *slog.Logger
 }
 
-func New(log *slog.Logger, service TaskService) *Handler {
+func New(log *slog.Logger, service TaskService, schedules ScheduleService, events Subscriber) *Handler {
 	return &Handler{
 		taskService: service,
+		schedules:   schedules,
+		events:      events,
 		log:         log,
 	}
 }
@@ -32,13 +49,30 @@ func New(log *slog.Logger, service TaskService) *Handler {
 func (h *Handler) InitRoutes() *gin.Engine {
 	router := gin.New()
 	router.Use(middleware.Metrics())
+	router.NoRoute(h.NotFound)
 	api := router.Group("/api")
 	{
+		// gin treats everything after the colon as a parameter and cannot register the literal path, so this route
+		// catches every POST /api/tasks<suffix>. TaskMethod answers like the router to anything but :batch
+		api.POST("/tasks:method", h.TaskMethod)
 		tasks := api.Group("/tasks")
 		{
 			tasks.POST("", h.CreateTask)
 			tasks.GET("", h.GetAllTasks)
+			tasks.GET("/events", h.AllTaskEvents)
 			tasks.GET("/:id", h.GetTask)
+			tasks.GET("/:id/children", h.GetTaskChildren)
+			tasks.GET("/:id/events", h.TaskEvents)
+			tasks.GET("/:id/wait", h.WaitTask)
+			tasks.POST("/:id/cancel", h.CancelTask)
+		}
+		api.POST("/workflows", h.CreateWorkflow)
+		schedules := api.Group("/schedules")
+		{
+			schedules.POST("", h.CreateSchedule)
+			schedules.GET("", h.GetAllSchedules)
+			schedules.GET("/:id", h.GetSchedule)
+			schedules.DELETE("/:id", h.DeleteSchedule)
 		}
 	}
 	return router
@@ -46,10 +80,55 @@ func (h *Handler) InitRoutes() *gin.Engine {
 
 type TaskResponse struct {
 	ID               int64           `json:"id"`
+	Type             string          `json:"type"`
 	State            model.TaskState `json:"state"`
+	Priority         int             `json:"priority"`
 	CreatedAt        time.Time       `json:"created_at"`
 	ProcessStartedAt *time.Time      `json:"process_started_at"`
 	ProcessEndedAt   *time.Time      `json:"process_ended_at"`
+	Attempts         int             `json:"attempts"`
+	MaxAttempts      int             `json:"max_attempts"`
+	NextRunAt        *time.Time      `json:"next_run_at"`
+	RunAt            *time.Time      `json:"run_at"`
+	DependsOn        []int64         `json:"depends_on,omitempty"`
+	ParentID         *int64          `json:"parent_id,omitempty"`
+	Timeout          *string         `json:"timeout"`
+	Deadline         *time.Time      `json:"deadline"`
+	Payload          json.RawMessage `json:"payload"`
+	Result           json.RawMessage `json:"result"`
+	Error            string          `json:"error,omitempty"`
+	ErrorCode        string          `json:"error_code,omitempty"`
+	CallbackURL      string          `json:"callback_url,omitempty"`
+}
+
+func newTaskResponse(task model.Task) TaskResponse {
+	var timeout *string
+	if task.Timeout > 0 {
+		formatted := task.Timeout.String()
+		timeout = &formatted
+	}
+	return TaskResponse{
+		ID:               task.ID,
+		Type:             task.Type,
+		State:            task.State,
+		Priority:         task.Priority,
+		CreatedAt:        task.CreatedAt,
+		ProcessStartedAt: task.ProcessStartedAt,
+		ProcessEndedAt:   task.ProcessEndedAt,
+		Attempts:         task.Attempts,
+		MaxAttempts:      task.RetryPolicy.MaxAttempts,
+		NextRunAt:        task.NextRunAt,
+		RunAt:            task.RunAt,
+		DependsOn:        task.DependsOn,
+		ParentID:         task.ParentID,
+		Timeout:          timeout,
+		Deadline:         task.Deadline,
+		Payload:          task.Payload,
+		Result:           task.Result,
+		Error:            task.Error,
+		ErrorCode:        task.ErrorCode,
+		CallbackURL:      task.CallbackURL,
+	}
 }
 
 func (h *Handler) GetTask(c *gin.Context) {
@@ -59,51 +138,177 @@ func (h *Handler) GetTask(c *gin.Context) {
 		return
 	}
 	task, err := h.taskService.GetTaskByID(c, taskID)
+	if errors.Is(err, service.ErrTaskNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, newTaskResponse(task))
+}
+
+// GetTaskChildren returns tasks spawned by the handler of a task, oldest first
+func (h *Handler) GetTaskChildren(c *gin.Context) {
+	taskID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+	children, err := h.taskService.GetTaskChildren(c, taskID)
+	if errors.Is(err, service.ErrTaskNotFound) {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Task not found"})
 		return
 	}
-	response := TaskResponse{
-		ID:               task.ID,
-		State:            task.State,
-		CreatedAt:        task.CreatedAt,
-		ProcessStartedAt: task.ProcessStartedAt,
-		ProcessEndedAt:   task.ProcessEndedAt,
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response := make([]TaskResponse, 0, len(children))
+	for _, child := range children {
+		response = append(response, newTaskResponse(child))
 	}
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, gin.H{"tasks": response})
 }
 
+// GetAllTasks returns a page of tasks. Supported query parameters are limit, cursor, state (repeated
+// or comma separated), created_after and created_before in RFC 3339 format and order (asc or desc)
 func (h *Handler) GetAllTasks(c *gin.Context) {
-	tasks, err := h.taskService.GetAllTasks(c)
+	query, err := parseTaskQuery(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := h.taskService.GetAllTasks(c, query)
+	if errors.Is(err, service.ErrInvalidQuery) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 	var response []TaskResponse
-	for _, task := range tasks {
-		response = append(
-			response,
-			TaskResponse{
-				ID:               task.ID,
-				State:            task.State,
-				CreatedAt:        task.CreatedAt,
-				ProcessStartedAt: task.ProcessStartedAt,
-				ProcessEndedAt:   task.ProcessEndedAt,
-			},
-		)
+	for _, task := range page.Tasks {
+		response = append(response, newTaskResponse(task))
 	}
-	if len(tasks) == 0 {
+	if len(page.Tasks) == 0 {
 		c.JSON(http.StatusOK, gin.H{"tasks": "there are no any task"})
+	} else if page.NextCursor != "" {
+		c.JSON(http.StatusOK, gin.H{"tasks": response, "next_cursor": page.NextCursor})
 	} else {
 		c.JSON(http.StatusOK, gin.H{"tasks": response})
 	}
-
 }
 
 func (h *Handler) CreateTask(c *gin.Context) {
-	taskID, err := h.taskService.CreateTask(c)
+	var request CreateTaskRequest
+	if err := bindOptionalJSON(c, &request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return
+	}
+	spec, err := request.spec()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+		return
+	}
+	spec.IdempotencyKey = c.GetHeader(IdempotencyKeyHeader)
+	if len(spec.IdempotencyKey) > maxIdempotencyKeyLength {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"Error": fmt.Sprintf("%s must not be longer than %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength)},
+		)
+		return
+	}
+
+	taskID, err := h.taskService.CreateTask(c, spec)
+	if errors.Is(err, service.ErrInvalidTaskSpec) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrIdempotencyConflict) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"Error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrQueueFull) || errors.Is(err, service.ErrShuttingDown) {
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"Error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"Task created with ID": taskID})
 }
+
+// TaskMethod dispatches custom methods of the task collection, such as POST /api/tasks:batch
+func (h *Handler) TaskMethod(c *gin.Context) {
+	switch c.Param("method") {
+	case ":batch":
+		h.CreateTasks(c)
+	default:
+		h.NotFound(c)
+	}
+}
+
+// NotFound responds to requests which match no route
+func (h *Handler) NotFound(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Not found"})
+}
+
+// CreateTasks creates tasks from a JSON array of task requests at once and returns their IDs in the same order
+func (h *Handler) CreateTasks(c *gin.Context) {
+	var requests []CreateTaskRequest
+	if err := c.ShouldBindJSON(&requests); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return
+	}
+	specs := make([]model.TaskSpec, len(requests))
+	for i, request := range requests {
+		spec, err := request.spec()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"Error": fmt.Sprintf("task %d: %s", i, err)})
+			return
+		}
+		specs[i] = spec
+	}
+
+	ids, err := h.taskService.CreateTasks(c, specs)
+	if errors.Is(err, service.ErrInvalidTaskSpec) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrQueueFull) || errors.Is(err, service.ErrShuttingDown) {
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"Error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ids": ids})
+}
+
+func (h *Handler) CancelTask(c *gin.Context) {
+	taskID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+	task, err := h.taskService.CancelTask(c, taskID)
+	switch {
+	case errors.Is(err, service.ErrTaskNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	case errors.Is(err, service.ErrTaskFinished):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Task is already finished"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, newTaskResponse(task))
+}
@@ -4,13 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"io-load-api/internal/broker"
 	"io-load-api/internal/model"
+	"io-load-api/internal/service"
 	"io-load-api/internal/transport/http/handler"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -19,28 +23,68 @@ type TaskServiceMock struct {
 	mock.Mock
 }
 
-func (m *TaskServiceMock) CreateTask(ctx context.Context) (int64, error) {
-	args := m.Called(ctx)
+func (m *TaskServiceMock) CreateTask(ctx context.Context, spec model.TaskSpec) (int64, error) {
+	args := m.Called(ctx, spec)
 	return args.Get(0).(int64), args.Error(1)
 }
 
+func (m *TaskServiceMock) CreateTasks(ctx context.Context, specs []model.TaskSpec) ([]int64, error) {
+	args := m.Called(ctx, specs)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
 func (m *TaskServiceMock) GetTaskByID(ctx context.Context, id int64) (model.Task, error) {
 	args := m.Called(ctx, id)
 	return args.Get(0).(model.Task), args.Error(1)
 }
 
-func (m *TaskServiceMock) GetAllTasks(ctx context.Context) ([]model.Task, error) {
-	args := m.Called(ctx)
+func (m *TaskServiceMock) GetAllTasks(ctx context.Context, query model.TaskQuery) (model.TaskPage, error) {
+	args := m.Called(ctx, query)
+	return args.Get(0).(model.TaskPage), args.Error(1)
+}
+
+func (m *TaskServiceMock) CancelTask(ctx context.Context, id int64) (model.Task, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(model.Task), args.Error(1)
+}
+
+func (m *TaskServiceMock) GetTaskChildren(ctx context.Context, id int64) ([]model.Task, error) {
+	args := m.Called(ctx, id)
 	return args.Get(0).([]model.Task), args.Error(1)
 }
 
+func (m *TaskServiceMock) CreateWorkflow(ctx context.Context, nodes []model.WorkflowNode) (map[string]int64, error) {
+	args := m.Called(ctx, nodes)
+	return args.Get(0).(map[string]int64), args.Error(1)
+}
+
+// SubscriberStub replays changes and then ends the subscription unless keepOpen is set
+type SubscriberStub struct {
+	changes  []model.Task
+	keepOpen bool
+	taskID   int64
+	canceled bool
+}
+
+func (s *SubscriberStub) Subscribe(taskID int64) (<-chan model.Task, func()) {
+	s.taskID = taskID
+	changes := make(chan model.Task, len(s.changes))
+	for _, task := range s.changes {
+		changes <- task
+	}
+	if !s.keepOpen {
+		close(changes)
+	}
+	return changes, func() { s.canceled = true }
+}
+
 func TestCreateTask(t *testing.T) {
 	mockService := new(TaskServiceMock)
 	logger := slog.Default()
 
-	h := handler.New(logger, mockService)
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
 
-	mockService.On("CreateTask", mock.Anything).Return(int64(1), nil)
+	mockService.On("CreateTask", mock.Anything, model.TaskSpec{}).Return(int64(1), nil)
 
 	router := h.InitRoutes()
 
@@ -55,11 +99,240 @@ func TestCreateTask(t *testing.T) {
 	mockService.AssertExpectations(t)
 }
 
+func TestCreateTask_WithOptions(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	spec := model.TaskSpec{
+		Type:        "fetch_url",
+		Priority:    10,
+		RetryPolicy: &model.RetryPolicy{MaxAttempts: 5, BaseDelay: 500 * time.Millisecond, Multiplier: 3, Jitter: 0.1},
+		Payload:     json.RawMessage(`{"url": "http://example.com"}`),
+	}
+	mockService.On("CreateTask", mock.Anything, spec).Return(int64(1), nil)
+
+	router := h.InitRoutes()
+
+	body := `{
+		"type": "fetch_url",
+		"priority": 10,
+		"retry": {"max_attempts": 5, "base_delay": "500ms", "multiplier": 3, "jitter": 0.1},
+		"payload": {"url": "http://example.com"}
+	}`
+	req, _ := http.NewRequest("POST", "/api/tasks", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestCreateTask_WithTimeoutAndDeadline(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	deadline := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	spec := model.TaskSpec{Timeout: 10 * time.Second, Deadline: &deadline}
+	mockService.On("CreateTask", mock.Anything, mock.MatchedBy(func(actual model.TaskSpec) bool {
+		return actual.Timeout == spec.Timeout && actual.Deadline != nil && actual.Deadline.Equal(deadline)
+	})).Return(int64(1), nil)
+
+	router := h.InitRoutes()
+
+	body := `{"timeout": "10s", "deadline": "2030-01-02T03:04:05Z"}`
+	req, _ := http.NewRequest("POST", "/api/tasks", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestCreateTask_Scheduled(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	runAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	mockService.On("CreateTask", mock.Anything, mock.MatchedBy(func(actual model.TaskSpec) bool {
+		return actual.RunAt != nil && actual.RunAt.Equal(runAt) && actual.Delay == 0
+	})).Return(int64(1), nil)
+	mockService.On("CreateTask", mock.Anything, mock.MatchedBy(func(actual model.TaskSpec) bool {
+		return actual.RunAt == nil && actual.Delay == 10*time.Minute
+	})).Return(int64(2), nil)
+
+	router := h.InitRoutes()
+
+	for _, body := range []string{`{"run_at": "2030-01-02T03:04:05Z"}`, `{"delay": "10m"}`} {
+		req, _ := http.NewRequest("POST", "/api/tasks", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestCreateTask_InvalidBody(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	router := h.InitRoutes()
+
+	bodies := []string{
+		`{"retry":`,
+		`{"retry": {"base_delay": "soon"}}`,
+		`{"timeout": "forever"}`,
+		`{"deadline": "tomorrow"}`,
+		`{"delay": "later"}`,
+	}
+	for _, body := range bodies {
+		req, _ := http.NewRequest("POST", "/api/tasks", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	}
+	mockService.AssertNotCalled(t, "CreateTask", mock.Anything, mock.Anything)
+}
+
+func TestCreateTask_QueueFull(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	mockService.On("CreateTask", mock.Anything, model.TaskSpec{}).Return(int64(-1), service.ErrQueueFull)
+
+	router := h.InitRoutes()
+
+	req, _ := http.NewRequest("POST", "/api/tasks", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	mockService.AssertExpectations(t)
+}
+
+func TestCreateTask_IdempotencyKey(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	mockService.On("CreateTask", mock.Anything, model.TaskSpec{IdempotencyKey: "key-1"}).Return(int64(3), nil).Once()
+	mockService.On("CreateTask", mock.Anything, model.TaskSpec{Type: "other", IdempotencyKey: "key-1"}).
+		Return(int64(-1), fmt.Errorf("service.CreateTask: %w", service.ErrIdempotencyConflict)).Once()
+
+	router := h.InitRoutes()
+
+	req, _ := http.NewRequest("POST", "/api/tasks", nil)
+	req.Header.Set(handler.IdempotencyKeyHeader, "key-1")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"Task created with ID": 3}`, rec.Body.String())
+
+	req, _ = http.NewRequest("POST", "/api/tasks", strings.NewReader(`{"type": "other"}`))
+	req.Header.Set(handler.IdempotencyKeyHeader, "key-1")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	req, _ = http.NewRequest("POST", "/api/tasks", nil)
+	req.Header.Set(handler.IdempotencyKeyHeader, strings.Repeat("k", 256))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestCreateTasks(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	specs := []model.TaskSpec{{}, {Type: "fetch_url", Payload: json.RawMessage(`{"url": "http://example.com"}`)}}
+	mockService.On("CreateTasks", mock.Anything, specs).Return([]int64{1, 2}, nil)
+
+	router := h.InitRoutes()
+
+	body := `[{}, {"type": "fetch_url", "payload": {"url": "http://example.com"}}]`
+	req, _ := http.NewRequest("POST", "/api/tasks:batch", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"ids": [1, 2]}`, rec.Body.String())
+
+	mockService.AssertExpectations(t)
+}
+
+func TestCreateTasks_InvalidRequest(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	router := h.InitRoutes()
+
+	cases := []struct {
+		path string
+		body string
+		code int
+	}{
+		{"/api/tasks:batch", `{"type": "fetch_url"}`, http.StatusBadRequest},
+		{"/api/tasks:batch", `[{}, {"timeout": "soon"}]`, http.StatusBadRequest},
+		{"/api/tasks:unknown", `[]`, http.StatusNotFound},
+		{"/api/tasks:batchx", `[]`, http.StatusNotFound},
+		{"/api/tasksx", `[]`, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest("POST", tc.path, strings.NewReader(tc.body))
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, tc.code, rec.Code, tc.body)
+		if tc.code == http.StatusNotFound {
+			// Unknown methods look like any other missing route
+			assert.JSONEq(t, `{"error": "Not found"}`, rec.Body.String(), tc.path)
+		}
+	}
+
+	req, _ := http.NewRequest("POST", "/api/nothing", strings.NewReader(`[]`))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.JSONEq(t, `{"error": "Not found"}`, rec.Body.String())
+	mockService.AssertNotCalled(t, "CreateTasks", mock.Anything, mock.Anything)
+}
+
 func TestGetTask(t *testing.T) {
 	mockService := new(TaskServiceMock)
 	logger := slog.Default()
 
-	h := handler.New(logger, mockService)
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
 
 	createdAt := time.Now().Truncate(time.Second)
 	task := model.Task{
@@ -83,10 +356,20 @@ func TestGetTask(t *testing.T) {
 
 	expectedJSON := map[string]interface{}{
 		"id":                 float64(1),
+		"type":               "",
 		"state":              string(task.State),
+		"priority":           float64(0),
 		"created_at":         createdAt.Format(time.RFC3339),
 		"process_started_at": nil,
 		"process_ended_at":   nil,
+		"attempts":           float64(0),
+		"max_attempts":       float64(0),
+		"next_run_at":        nil,
+		"run_at":             nil,
+		"timeout":            nil,
+		"deadline":           nil,
+		"payload":            nil,
+		"result":             nil,
 	}
 
 	var actual map[string]interface{}
@@ -98,11 +381,70 @@ func TestGetTask(t *testing.T) {
 	mockService.AssertExpectations(t)
 }
 
+func TestGetTask_WithResult(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	task := model.Task{
+		ID:      1,
+		State:   model.CompletedState,
+		Payload: json.RawMessage(`{"url": "http://example.com"}`),
+		Result:  json.RawMessage(`{"status": 200}`),
+	}
+	mockService.On("GetTaskByID", mock.Anything, int64(1)).Return(task, nil)
+
+	router := h.InitRoutes()
+
+	req, _ := http.NewRequest("GET", "/api/tasks/1", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var actual map[string]interface{}
+	err := json.Unmarshal(rec.Body.Bytes(), &actual)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"url": "http://example.com"}, actual["payload"])
+	assert.Equal(t, map[string]interface{}{"status": float64(200)}, actual["result"])
+
+	mockService.AssertExpectations(t)
+}
+
+func TestGetTask_Failed(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	task := model.Task{ID: 1, State: model.FailedState, Error: "task failed", ErrorCode: model.HandlerErrorCode}
+	mockService.On("GetTaskByID", mock.Anything, int64(1)).Return(task, nil)
+
+	router := h.InitRoutes()
+
+	req, _ := http.NewRequest("GET", "/api/tasks/1", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var actual map[string]interface{}
+	err := json.Unmarshal(rec.Body.Bytes(), &actual)
+	assert.NoError(t, err)
+	assert.Equal(t, "task failed", actual["error"])
+	assert.Equal(t, model.HandlerErrorCode, actual["error_code"])
+
+	mockService.AssertExpectations(t)
+}
+
 func TestGetTask_InvalidID(t *testing.T) {
 	mockService := new(TaskServiceMock)
 	logger := slog.Default()
 
-	h := handler.New(logger, mockService)
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
 
 	router := h.InitRoutes()
 
@@ -119,7 +461,7 @@ func TestGetAllTasks(t *testing.T) {
 	mockService := new(TaskServiceMock)
 	logger := slog.Default()
 
-	h := handler.New(logger, mockService)
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
 
 	createdAt := time.Now().Truncate(time.Second)
 	tasks := []model.Task{
@@ -132,7 +474,7 @@ func TestGetAllTasks(t *testing.T) {
 		},
 	}
 
-	mockService.On("GetAllTasks", mock.Anything).Return(tasks, nil)
+	mockService.On("GetAllTasks", mock.Anything, model.TaskQuery{}).Return(model.TaskPage{Tasks: tasks}, nil)
 
 	router := h.InitRoutes()
 
@@ -151,10 +493,20 @@ func TestGetAllTasks(t *testing.T) {
 		"tasks": []interface{}{
 			map[string]interface{}{
 				"id":                 float64(1),
+				"type":               "",
 				"state":              string(tasks[0].State),
+				"priority":           float64(0),
 				"created_at":         createdAt.Format(time.RFC3339),
 				"process_started_at": nil,
 				"process_ended_at":   nil,
+				"attempts":           float64(0),
+				"max_attempts":       float64(0),
+				"next_run_at":        nil,
+				"run_at":             nil,
+				"timeout":            nil,
+				"deadline":           nil,
+				"payload":            nil,
+				"result":             nil,
 			},
 		},
 	}
@@ -168,9 +520,9 @@ func TestGetAllTasks_NoTasks(t *testing.T) {
 	mockService := new(TaskServiceMock)
 	logger := slog.Default()
 
-	h := handler.New(logger, mockService)
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
 
-	mockService.On("GetAllTasks", mock.Anything).Return([]model.Task{}, nil)
+	mockService.On("GetAllTasks", mock.Anything, model.TaskQuery{}).Return(model.TaskPage{}, nil)
 
 	router := h.InitRoutes()
 
@@ -194,13 +546,75 @@ func TestGetAllTasks_NoTasks(t *testing.T) {
 	mockService.AssertExpectations(t)
 }
 
+func TestGetAllTasks_Query(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	createdAfter := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	query := model.TaskQuery{
+		States:       []model.TaskState{model.FailedState, model.TimedOutState, model.PendingState},
+		CreatedAfter: &createdAfter,
+		Descending:   true,
+		Limit:        1,
+		Cursor:       "abc",
+	}
+	page := model.TaskPage{Tasks: []model.Task{{ID: 5, State: model.FailedState}}, NextCursor: "def"}
+	mockService.On("GetAllTasks", mock.Anything, query).Return(page, nil)
+
+	router := h.InitRoutes()
+
+	req, _ := http.NewRequest(
+		"GET",
+		"/api/tasks?state=failed,TIMED_OUT&state=PENDING&created_after=2024-05-01T10:00:00Z&order=desc&limit=1&cursor=abc",
+		nil,
+	)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var actual map[string]interface{}
+	err := json.Unmarshal(rec.Body.Bytes(), &actual)
+	assert.NoError(t, err)
+	assert.Equal(t, "def", actual["next_cursor"])
+	assert.Len(t, actual["tasks"], 1)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestGetAllTasks_InvalidQuery(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	mockService.On("GetAllTasks", mock.Anything, model.TaskQuery{Cursor: "bad"}).
+		Return(model.TaskPage{}, fmt.Errorf("service.GetAllTasks: %w: invalid cursor", service.ErrInvalidQuery))
+
+	router := h.InitRoutes()
+
+	for _, rawQuery := range []string{"limit=ten", "state=UNKNOWN", "created_before=yesterday", "order=up", "cursor=bad"} {
+		req, _ := http.NewRequest("GET", "/api/tasks?"+rawQuery, nil)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, rawQuery)
+	}
+
+	mockService.AssertExpectations(t)
+}
+
 func TestGetTask_NotFound(t *testing.T) {
 	mockService := new(TaskServiceMock)
 	logger := slog.Default()
 
-	h := handler.New(logger, mockService)
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
 
-	mockService.On("GetTaskByID", mock.Anything, int64(1)).Return(model.Task{}, errors.New("task not found"))
+	mockService.On("GetTaskByID", mock.Anything, int64(1)).Return(model.Task{}, service.ErrTaskNotFound)
 
 	router := h.InitRoutes()
 
@@ -214,3 +628,295 @@ func TestGetTask_NotFound(t *testing.T) {
 
 	mockService.AssertExpectations(t)
 }
+
+func TestGetTask_StoreError(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	mockService.On("GetTaskByID", mock.Anything, int64(1)).Return(model.Task{}, errors.New("connection refused"))
+
+	router := h.InitRoutes()
+
+	req, _ := http.NewRequest("GET", "/api/tasks/1", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestCancelTask(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	task := model.Task{ID: 1, State: model.CancelledState}
+	mockService.On("CancelTask", mock.Anything, int64(1)).Return(task, nil)
+
+	router := h.InitRoutes()
+
+	req, _ := http.NewRequest("POST", "/api/tasks/1/cancel", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var actual map[string]interface{}
+	err := json.Unmarshal(rec.Body.Bytes(), &actual)
+	assert.NoError(t, err)
+	assert.Equal(t, string(model.CancelledState), actual["state"])
+
+	mockService.AssertExpectations(t)
+}
+
+func TestCancelTask_Errors(t *testing.T) {
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{service.ErrTaskNotFound, http.StatusNotFound},
+		{service.ErrTaskFinished, http.StatusConflict},
+		{errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		mockService := new(TaskServiceMock)
+		logger := slog.Default()
+
+		h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+		mockService.On("CancelTask", mock.Anything, int64(1)).Return(model.Task{}, tc.err)
+
+		router := h.InitRoutes()
+
+		req, _ := http.NewRequest("POST", "/api/tasks/1/cancel", nil)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, tc.code, rec.Code)
+		mockService.AssertExpectations(t)
+	}
+}
+
+func TestGetTaskChildren(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	parentID := int64(1)
+	children := []model.Task{
+		{ID: 2, State: model.CompletedState, ParentID: &parentID},
+		{ID: 3, State: model.PendingState, ParentID: &parentID},
+	}
+	mockService.On("GetTaskChildren", mock.Anything, int64(1)).Return(children, nil)
+	mockService.On("GetTaskChildren", mock.Anything, int64(4)).Return([]model.Task(nil), nil)
+	mockService.On("GetTaskChildren", mock.Anything, int64(5)).Return([]model.Task(nil), service.ErrTaskNotFound)
+
+	router := h.InitRoutes()
+
+	req, _ := http.NewRequest("GET", "/api/tasks/1/children", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var actual struct {
+		Tasks []handler.TaskResponse `json:"tasks"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &actual))
+	assert.Len(t, actual.Tasks, 2)
+	assert.Equal(t, int64(3), actual.Tasks[1].ID)
+	assert.Equal(t, &parentID, actual.Tasks[1].ParentID)
+
+	req, _ = http.NewRequest("GET", "/api/tasks/4/children", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"tasks": []}`, rec.Body.String())
+
+	req, _ = http.NewRequest("GET", "/api/tasks/5/children", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestTaskEvents(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	events := &SubscriberStub{changes: []model.Task{
+		{ID: 1, State: model.ProcessingState},
+		{ID: 1, State: model.CompletedState},
+		{ID: 1, State: model.PendingState},
+	}}
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), events)
+
+	mockService.On("GetTaskByID", mock.Anything, int64(1)).Return(model.Task{ID: 1, State: model.PendingState}, nil)
+
+	router := h.InitRoutes()
+
+	req, _ := http.NewRequest("GET", "/api/tasks/1/events", nil)
+	rec := newStreamRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/event-stream")
+	// The stream ends at the final state
+	assert.Equal(t, []model.TaskState{model.PendingState, model.ProcessingState, model.CompletedState}, eventStates(t, rec.Body.String()))
+	assert.Equal(t, int64(1), events.taskID)
+	assert.True(t, events.canceled)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestTaskEvents_NotFound(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	mockService.On("GetTaskByID", mock.Anything, int64(1)).Return(model.Task{}, service.ErrTaskNotFound)
+
+	router := h.InitRoutes()
+
+	req, _ := http.NewRequest("GET", "/api/tasks/1/events", nil)
+	rec := newStreamRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestAllTaskEvents(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	events := &SubscriberStub{taskID: -1, changes: []model.Task{
+		{ID: 1, State: model.CompletedState},
+		{ID: 2, State: model.ProcessingState},
+	}}
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), events)
+
+	router := h.InitRoutes()
+
+	req, _ := http.NewRequest("GET", "/api/tasks/events", nil)
+	rec := newStreamRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []model.TaskState{model.CompletedState, model.ProcessingState}, eventStates(t, rec.Body.String()))
+	assert.Equal(t, broker.AllTasks, events.taskID)
+}
+
+func TestWaitTask(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	events := &SubscriberStub{keepOpen: true, changes: []model.Task{
+		{ID: 1, State: model.RetryingState},
+		{ID: 1, State: model.FailedState, Error: "connection reset"},
+	}}
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), events)
+
+	mockService.On("GetTaskByID", mock.Anything, int64(1)).Return(model.Task{ID: 1, State: model.ProcessingState}, nil)
+
+	router := h.InitRoutes()
+
+	req, _ := http.NewRequest("GET", "/api/tasks/1/wait?timeout=1m", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var actual handler.TaskResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &actual))
+	assert.Equal(t, model.FailedState, actual.State)
+	assert.Equal(t, "connection reset", actual.Error)
+	assert.True(t, events.canceled)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestWaitTask_Timeout(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), &SubscriberStub{keepOpen: true})
+
+	mockService.On("GetTaskByID", mock.Anything, int64(1)).Return(model.Task{ID: 1, State: model.ProcessingState}, nil)
+
+	router := h.InitRoutes()
+
+	req, _ := http.NewRequest("GET", "/api/tasks/1/wait?timeout=20ms", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var actual handler.TaskResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &actual))
+	assert.Equal(t, model.ProcessingState, actual.State)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestWaitTask_InvalidTimeout(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	logger := slog.Default()
+
+	h := handler.New(logger, mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	router := h.InitRoutes()
+
+	for _, timeout := range []string{"soon", "-1s", "1h"} {
+		req, _ := http.NewRequest("GET", "/api/tasks/1/wait?timeout="+timeout, nil)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, timeout)
+	}
+}
+
+// streamRecorder is a response recorder which can be used with gin.Context.Stream
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+	closed chan bool
+}
+
+func newStreamRecorder() *streamRecorder {
+	return &streamRecorder{httptest.NewRecorder(), make(chan bool)}
+}
+
+func (r *streamRecorder) CloseNotify() <-chan bool {
+	return r.closed
+}
+
+// eventStates returns task states sent in an event stream
+func eventStates(t *testing.T, stream string) []model.TaskState {
+	var states []model.TaskState
+	for _, line := range strings.Split(stream, "\n") {
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		var task handler.TaskResponse
+		assert.NoError(t, json.Unmarshal([]byte(data), &task))
+		states = append(states, task.State)
+	}
+	return states
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"io-load-api/internal/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RetryPolicyRequest struct {
+	MaxAttempts int     `json:"max_attempts"`
+	BaseDelay   string  `json:"base_delay"`
+	Multiplier  float64 `json:"multiplier"`
+	Jitter      float64 `json:"jitter"`
+}
+
+// CreateTaskRequest is an optional body of POST /api/tasks. Omitted options take defaults from config
+type CreateTaskRequest struct {
+	Type     string              `json:"type"`
+	Priority int                 `json:"priority"`
+	Retry    *RetryPolicyRequest `json:"retry"`
+	Timeout  string              `json:"timeout"`
+	Deadline *time.Time          `json:"deadline"`
+	// RunAt or Delay postpone the start of the task
+	RunAt *time.Time `json:"run_at"`
+	Delay string     `json:"delay"`
+	// DependsOn lists IDs of tasks which must complete before the task starts
+	DependsOn []int64         `json:"depends_on"`
+	Payload   json.RawMessage `json:"payload"`
+	// CallbackURL receives a webhook when the task completes or fails
+	CallbackURL string `json:"callback_url"`
+}
+
+func (r CreateTaskRequest) spec() (model.TaskSpec, error) {
+	spec := model.TaskSpec{Type: r.Type, Priority: r.Priority, DependsOn: r.DependsOn, CallbackURL: r.CallbackURL}
+	if string(r.Payload) != "null" {
+		spec.Payload = r.Payload
+	}
+	if r.Retry != nil {
+		policy := model.RetryPolicy{
+			MaxAttempts: r.Retry.MaxAttempts,
+			Multiplier:  r.Retry.Multiplier,
+			Jitter:      r.Retry.Jitter,
+		}
+		if r.Retry.BaseDelay != "" {
+			delay, err := time.ParseDuration(r.Retry.BaseDelay)
+			if err != nil {
+				return model.TaskSpec{}, fmt.Errorf("invalid retry base delay: %s", err)
+			}
+			policy.BaseDelay = delay
+		}
+		spec.RetryPolicy = &policy
+	}
+	if r.Timeout != "" {
+		timeout, err := time.ParseDuration(r.Timeout)
+		if err != nil {
+			return model.TaskSpec{}, fmt.Errorf("invalid timeout: %s", err)
+		}
+		spec.Timeout = timeout
+	}
+	if r.Delay != "" {
+		delay, err := time.ParseDuration(r.Delay)
+		if err != nil {
+			return model.TaskSpec{}, fmt.Errorf("invalid delay: %s", err)
+		}
+		spec.Delay = delay
+	}
+	spec.Deadline = r.Deadline
+	spec.RunAt = r.RunAt
+	return spec, nil
+}
+
+// bindOptionalJSON decodes request body into obj. Empty body leaves obj untouched
+func bindOptionalJSON(c *gin.Context, obj any) error {
+	if c.Request.Body == nil {
+		return nil
+	}
+	err := json.NewDecoder(c.Request.Body).Decode(obj)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+func parseTaskQuery(c *gin.Context) (model.TaskQuery, error) {
+	query := model.TaskQuery{Cursor: c.Query("cursor")}
+
+	if limit := c.Query("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil {
+			return model.TaskQuery{}, fmt.Errorf("invalid limit: %s", limit)
+		}
+		query.Limit = parsed
+	}
+
+	for _, states := range c.QueryArray("state") {
+		for _, state := range strings.Split(states, ",") {
+			taskState := model.TaskState(strings.ToUpper(strings.TrimSpace(state)))
+			if !taskState.Valid() {
+				return model.TaskQuery{}, fmt.Errorf("invalid state: %s", state)
+			}
+			query.States = append(query.States, taskState)
+		}
+	}
+
+	for param, target := range map[string]**time.Time{
+		"created_after":  &query.CreatedAfter,
+		"created_before": &query.CreatedBefore,
+	} {
+		if value := c.Query(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return model.TaskQuery{}, fmt.Errorf("invalid %s: %s", param, value)
+			}
+			*target = &parsed
+		}
+	}
+
+	switch order := c.DefaultQuery("order", "asc"); order {
+	case "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		return model.TaskQuery{}, fmt.Errorf("invalid order: %s", order)
+	}
+	return query, nil
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io-load-api/internal/model"
+	"io-load-api/internal/service"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type ScheduleService interface {
+	CreateSchedule(ctx context.Context, expr string, template model.TaskSpec) (model.Schedule, error)
+	GetScheduleByID(ctx context.Context, id int64) (model.Schedule, error)
+	GetAllSchedules(ctx context.Context) ([]model.Schedule, error)
+	DeleteSchedule(ctx context.Context, id int64) error
+}
+
+// CreateScheduleRequest is the body of POST /api/schedules. Task takes the same options as POST /api/tasks
+// except run_at and deadline
+type CreateScheduleRequest struct {
+	Cron string            `json:"cron"`
+	Task CreateTaskRequest `json:"task"`
+}
+
+type ScheduleResponse struct {
+	ID        int64                `json:"id"`
+	Cron      string               `json:"cron"`
+	Task      TaskTemplateResponse `json:"task"`
+	NextRunAt time.Time            `json:"next_run_at"`
+	LastRunAt *time.Time           `json:"last_run_at"`
+	CreatedAt time.Time            `json:"created_at"`
+}
+
+// TaskTemplateResponse describes tasks created by a schedule. Options which were not set are omitted
+type TaskTemplateResponse struct {
+	Type        string              `json:"type,omitempty"`
+	Priority    int                 `json:"priority"`
+	Retry       *RetryPolicyRequest `json:"retry,omitempty"`
+	Timeout     string              `json:"timeout,omitempty"`
+	Delay       string              `json:"delay,omitempty"`
+	Payload     json.RawMessage     `json:"payload,omitempty"`
+	CallbackURL string              `json:"callback_url,omitempty"`
+}
+
+func newScheduleResponse(schedule model.Schedule) ScheduleResponse {
+	template := schedule.Template
+	task := TaskTemplateResponse{
+		Type:        template.Type,
+		Priority:    template.Priority,
+		Payload:     template.Payload,
+		CallbackURL: template.CallbackURL,
+	}
+	if template.RetryPolicy != nil {
+		task.Retry = &RetryPolicyRequest{
+			MaxAttempts: template.RetryPolicy.MaxAttempts,
+			Multiplier:  template.RetryPolicy.Multiplier,
+			Jitter:      template.RetryPolicy.Jitter,
+		}
+		if template.RetryPolicy.BaseDelay > 0 {
+			task.Retry.BaseDelay = template.RetryPolicy.BaseDelay.String()
+		}
+	}
+	if template.Timeout > 0 {
+		task.Timeout = template.Timeout.String()
+	}
+	if template.Delay > 0 {
+		task.Delay = template.Delay.String()
+	}
+	return ScheduleResponse{
+		ID:        schedule.ID,
+		Cron:      schedule.Cron,
+		Task:      task,
+		NextRunAt: schedule.NextRunAt,
+		LastRunAt: schedule.LastRunAt,
+		CreatedAt: schedule.CreatedAt,
+	}
+}
+
+// CreateSchedule creates a recurring schedule from a cron expression and a task template
+func (h *Handler) CreateSchedule(c *gin.Context) {
+	var request CreateScheduleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	template, err := request.Task.spec()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule, err := h.schedules.CreateSchedule(c, request.Cron, template)
+	if errors.Is(err, service.ErrInvalidSchedule) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, newScheduleResponse(schedule))
+}
+
+func (h *Handler) GetAllSchedules(c *gin.Context) {
+	schedules, err := h.schedules.GetAllSchedules(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response := make([]ScheduleResponse, 0, len(schedules))
+	for _, schedule := range schedules {
+		response = append(response, newScheduleResponse(schedule))
+	}
+	c.JSON(http.StatusOK, gin.H{"schedules": response})
+}
+
+func (h *Handler) GetSchedule(c *gin.Context) {
+	scheduleID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+	schedule, err := h.schedules.GetScheduleByID(c, scheduleID)
+	if errors.Is(err, service.ErrScheduleNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, newScheduleResponse(schedule))
+}
+
+// DeleteSchedule stops a schedule. Tasks it has already created are kept
+func (h *Handler) DeleteSchedule(c *gin.Context) {
+	scheduleID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+	err = h.schedules.DeleteSchedule(c, scheduleID)
+	if errors.Is(err, service.ErrScheduleNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
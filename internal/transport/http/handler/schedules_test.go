@@ -0,0 +1,157 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io-load-api/internal/model"
+	"io-load-api/internal/service"
+	"io-load-api/internal/transport/http/handler"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type ScheduleServiceMock struct {
+	mock.Mock
+}
+
+func (m *ScheduleServiceMock) CreateSchedule(
+	ctx context.Context,
+	expr string,
+	template model.TaskSpec,
+) (model.Schedule, error) {
+	args := m.Called(ctx, expr, template)
+	return args.Get(0).(model.Schedule), args.Error(1)
+}
+
+func (m *ScheduleServiceMock) GetScheduleByID(ctx context.Context, id int64) (model.Schedule, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(model.Schedule), args.Error(1)
+}
+
+func (m *ScheduleServiceMock) GetAllSchedules(ctx context.Context) ([]model.Schedule, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.Schedule), args.Error(1)
+}
+
+func (m *ScheduleServiceMock) DeleteSchedule(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func TestCreateSchedule(t *testing.T) {
+	mockSchedules := new(ScheduleServiceMock)
+	h := handler.New(slog.Default(), new(TaskServiceMock), mockSchedules, new(SubscriberStub))
+
+	template := model.TaskSpec{Type: "fetch_url", Timeout: 10 * time.Second, Payload: json.RawMessage(`{"url":"x"}`)}
+	nextRunAt := time.Date(2030, 1, 1, 10, 15, 0, 0, time.UTC)
+	createdAt := time.Date(2030, 1, 1, 10, 7, 0, 0, time.UTC)
+	mockSchedules.On("CreateSchedule", mock.Anything, "*/15 * * * *", template).Return(model.Schedule{
+		ID:        1,
+		Cron:      "*/15 * * * *",
+		Template:  template,
+		NextRunAt: nextRunAt,
+		CreatedAt: createdAt,
+	}, nil)
+
+	body := `{"cron": "*/15 * * * *", "task": {"type": "fetch_url", "timeout": "10s", "payload": {"url":"x"}}}`
+	req, _ := http.NewRequest("POST", "/api/schedules", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	h.InitRoutes().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var actual map[string]any
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &actual))
+	assert.Equal(t, map[string]any{
+		"id":   float64(1),
+		"cron": "*/15 * * * *",
+		"task": map[string]any{
+			"type":     "fetch_url",
+			"priority": float64(0),
+			"timeout":  "10s",
+			"payload":  map[string]any{"url": "x"},
+		},
+		"next_run_at": nextRunAt.Format(time.RFC3339),
+		"last_run_at": nil,
+		"created_at":  createdAt.Format(time.RFC3339),
+	}, actual)
+	mockSchedules.AssertExpectations(t)
+}
+
+func TestCreateSchedule_Invalid(t *testing.T) {
+	mockSchedules := new(ScheduleServiceMock)
+	h := handler.New(slog.Default(), new(TaskServiceMock), mockSchedules, new(SubscriberStub))
+
+	mockSchedules.On("CreateSchedule", mock.Anything, "never", mock.Anything).
+		Return(model.Schedule{}, fmt.Errorf("%w: expected 5 fields, got 1", service.ErrInvalidSchedule))
+
+	router := h.InitRoutes()
+	for _, body := range []string{`{"cron": "never"}`, `{"cron": "* * * * *", "task": {"timeout": "forever"}}`, `[`} {
+		req, _ := http.NewRequest("POST", "/api/schedules", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+	mockSchedules.AssertNumberOfCalls(t, "CreateSchedule", 1)
+}
+
+func TestGetAllSchedules(t *testing.T) {
+	mockSchedules := new(ScheduleServiceMock)
+	h := handler.New(slog.Default(), new(TaskServiceMock), mockSchedules, new(SubscriberStub))
+
+	mockSchedules.On("GetAllSchedules", mock.Anything).Return([]model.Schedule{{ID: 1}, {ID: 2}}, nil)
+
+	req, _ := http.NewRequest("GET", "/api/schedules", nil)
+	rec := httptest.NewRecorder()
+
+	h.InitRoutes().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var actual struct {
+		Schedules []handler.ScheduleResponse `json:"schedules"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &actual))
+	assert.Len(t, actual.Schedules, 2)
+}
+
+func TestGetSchedule_NotFound(t *testing.T) {
+	mockSchedules := new(ScheduleServiceMock)
+	h := handler.New(slog.Default(), new(TaskServiceMock), mockSchedules, new(SubscriberStub))
+
+	mockSchedules.On("GetScheduleByID", mock.Anything, int64(7)).Return(model.Schedule{}, service.ErrScheduleNotFound)
+
+	req, _ := http.NewRequest("GET", "/api/schedules/7", nil)
+	rec := httptest.NewRecorder()
+
+	h.InitRoutes().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestDeleteSchedule(t *testing.T) {
+	mockSchedules := new(ScheduleServiceMock)
+	h := handler.New(slog.Default(), new(TaskServiceMock), mockSchedules, new(SubscriberStub))
+
+	mockSchedules.On("DeleteSchedule", mock.Anything, int64(1)).Return(nil)
+	mockSchedules.On("DeleteSchedule", mock.Anything, int64(2)).Return(service.ErrScheduleNotFound)
+
+	router := h.InitRoutes()
+	for id, status := range map[int]int{1: http.StatusNoContent, 2: http.StatusNotFound} {
+		req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/schedules/%d", id), nil)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, status, rec.Code)
+	}
+	mockSchedules.AssertExpectations(t)
+}
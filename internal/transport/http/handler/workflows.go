@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io-load-api/internal/model"
+	"io-load-api/internal/service"
+	"net/http"
+)
+
+// WorkflowTaskRequest is a task of a workflow. DependsOn lists keys of other tasks of the same workflow,
+// Task takes the same options as POST /api/tasks
+type WorkflowTaskRequest struct {
+	Key       string            `json:"key"`
+	DependsOn []string          `json:"depends_on"`
+	Task      CreateTaskRequest `json:"task"`
+}
+
+// CreateWorkflowRequest is the body of POST /api/workflows
+type CreateWorkflowRequest struct {
+	Tasks []WorkflowTaskRequest `json:"tasks"`
+}
+
+// CreateWorkflow creates a DAG of tasks at once and returns their IDs by keys
+func (h *Handler) CreateWorkflow(c *gin.Context) {
+	var request CreateWorkflowRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"Error": "Invalid request body"})
+		return
+	}
+	nodes := make([]model.WorkflowNode, len(request.Tasks))
+	for i, task := range request.Tasks {
+		spec, err := task.Task.spec()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"Error": fmt.Sprintf("task %q: %s", task.Key, err)})
+			return
+		}
+		nodes[i] = model.WorkflowNode{Key: task.Key, DependsOn: task.DependsOn, Spec: spec}
+	}
+
+	ids, err := h.taskService.CreateWorkflow(c, nodes)
+	if errors.Is(err, service.ErrInvalidTaskSpec) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrQueueFull) || errors.Is(err, service.ErrShuttingDown) {
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"Error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tasks": ids})
+}
@@ -0,0 +1,67 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io-load-api/internal/model"
+	"io-load-api/internal/service"
+	"io-load-api/internal/transport/http/handler"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateWorkflow(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	h := handler.New(slog.Default(), mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	nodes := []model.WorkflowNode{
+		{Key: "fetch", Spec: model.TaskSpec{Type: "fetch_url"}},
+		{Key: "parse", DependsOn: []string{"fetch"}, Spec: model.TaskSpec{Timeout: time.Minute, DependsOn: []int64{3}}},
+	}
+	mockService.On("CreateWorkflow", mock.Anything, nodes).Return(map[string]int64{"fetch": 4, "parse": 5}, nil)
+
+	body := `{"tasks": [
+		{"key": "fetch", "task": {"type": "fetch_url"}},
+		{"key": "parse", "depends_on": ["fetch"], "task": {"timeout": "1m", "depends_on": [3]}}
+	]}`
+	req, _ := http.NewRequest("POST", "/api/workflows", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	h.InitRoutes().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var actual map[string]map[string]int64
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &actual))
+	assert.Equal(t, map[string]int64{"fetch": 4, "parse": 5}, actual["tasks"])
+	mockService.AssertExpectations(t)
+}
+
+func TestCreateWorkflow_Invalid(t *testing.T) {
+	mockService := new(TaskServiceMock)
+	h := handler.New(slog.Default(), mockService, new(ScheduleServiceMock), new(SubscriberStub))
+
+	mockService.On("CreateWorkflow", mock.Anything, mock.Anything).
+		Return(map[string]int64(nil), fmt.Errorf("%w: dependencies of \"a\" form a cycle", service.ErrInvalidTaskSpec))
+
+	router := h.InitRoutes()
+	bodies := []string{
+		`{"tasks": [{"key": "a", "depends_on": ["a"]}]}`,
+		`{"tasks": [{"key": "a", "task": {"timeout": "forever"}}]}`,
+		`{"tasks": {}}`,
+	}
+	for _, body := range bodies {
+		req, _ := http.NewRequest("POST", "/api/workflows", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+	mockService.AssertNumberOfCalls(t, "CreateWorkflow", 1)
+}
@@ -0,0 +1,26 @@
+package backoff
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Exponential returns the delay before the retry following attempt. The delay grows as
+// base * multiplier^(attempt-1) and is randomized by up to jitter fraction of it in both directions
+func Exponential(base time.Duration, multiplier, jitter float64, attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := float64(base) * math.Pow(multiplier, float64(attempt-1))
+	if jitter > 0 {
+		delay += delay * jitter * (2*rand.Float64() - 1)
+	}
+	if delay >= math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	if delay < 0 {
+		return 0
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,27 @@
+package backoff_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io-load-api/internal/utils/backoff"
+	"testing"
+	"time"
+)
+
+func TestExponential(t *testing.T) {
+	assert.Equal(t, time.Second, backoff.Exponential(time.Second, 2, 0, 1))
+	assert.Equal(t, 2*time.Second, backoff.Exponential(time.Second, 2, 0, 2))
+	assert.Equal(t, 8*time.Second, backoff.Exponential(time.Second, 2, 0, 4))
+	assert.Equal(t, time.Second, backoff.Exponential(time.Second, 2, 0, 0))
+}
+
+func TestExponential_Jitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		delay := backoff.Exponential(10*time.Second, 2, 0.5, 2)
+		assert.GreaterOrEqual(t, delay, 10*time.Second)
+		assert.LessOrEqual(t, delay, 30*time.Second)
+	}
+}
+
+func TestExponential_Overflow(t *testing.T) {
+	assert.Equal(t, time.Duration(1<<63-1), backoff.Exponential(time.Hour, 10, 0, 100))
+}
@@ -0,0 +1,198 @@
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxYears bounds the search for the next activation, so expressions which never match, such as Feb 30, terminate
+const maxYears = 5
+
+// Schedule is a parsed cron expression with minute, hour, day of month, month and day of week fields
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny are set for fields given as *. As in standard cron, if both day fields are restricted,
+	// a day matches when either of them does
+	domAny, dowAny bool
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a standard five field cron expression or one of macros such as @hourly.
+// Fields support *, numbers, names of months and days, ranges, lists and steps, e.g. "*/15 9-17 * * mon-fri"
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := macros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+
+	var (
+		schedule Schedule
+		err      error
+	)
+	if schedule.minute, err = minuteField.parse(fields[0]); err != nil {
+		return Schedule{}, err
+	}
+	if schedule.hour, err = hourField.parse(fields[1]); err != nil {
+		return Schedule{}, err
+	}
+	if schedule.dom, err = domField.parse(fields[2]); err != nil {
+		return Schedule{}, err
+	}
+	if schedule.month, err = monthField.parse(fields[3]); err != nil {
+		return Schedule{}, err
+	}
+	if schedule.dow, err = dowField.parse(fields[4]); err != nil {
+		return Schedule{}, err
+	}
+	// Both 0 and 7 stand for Sunday
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow |= 1
+	}
+	schedule.domAny = fields[2] == "*"
+	schedule.dowAny = fields[4] == "*"
+	return schedule, nil
+}
+
+// parse returns a bit set of values allowed by a comma separated list of ranges
+func (f field) parse(value string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(value, ",") {
+		bitsOfPart, err := f.parseRange(part)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q: %w", f.name, value, err)
+		}
+		set |= bitsOfPart
+	}
+	return set, nil
+}
+
+func (f field) parseRange(part string) (uint64, error) {
+	rangePart, stepPart, hasStep := strings.Cut(part, "/")
+	step := 1
+	if hasStep {
+		var err error
+		step, err = strconv.Atoi(stepPart)
+		if err != nil || step < 1 {
+			return 0, errors.New("step must be a positive number")
+		}
+	}
+
+	var low, high int
+	if rangePart == "*" {
+		low, high = f.min, f.max
+	} else {
+		lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+		var err error
+		if low, err = f.value(lowPart); err != nil {
+			return 0, err
+		}
+		high = low
+		if isRange {
+			if high, err = f.value(highPart); err != nil {
+				return 0, err
+			}
+		} else if hasStep {
+			// "5/10" means every 10 starting at 5
+			high = f.max
+		}
+		if low > high {
+			return 0, fmt.Errorf("range start %d is after its end %d", low, high)
+		}
+	}
+
+	var set uint64
+	for v := low; v <= high; v += step {
+		set |= 1 << v
+	}
+	return set, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%d is out of range %d-%d", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first activation time strictly after t, in the location of t.
+// It returns the zero time if the expression has no activation in the next years
+func (s Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(maxYears, 0, 0)
+
+	for t.Before(end) {
+		if !has(s.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(s.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(s.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s Schedule) dayMatches(t time.Time) bool {
+	dom := has(s.dom, t.Day())
+	dow := has(s.dow, int(t.Weekday()))
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func has(set uint64, v int) bool {
+	return set&(1<<v) != 0
+}
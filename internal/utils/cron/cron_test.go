@@ -0,0 +1,61 @@
+package cron_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io-load-api/internal/utils/cron"
+	"testing"
+	"time"
+)
+
+func TestSchedule_Next(t *testing.T) {
+	start := time.Date(2030, 1, 1, 10, 7, 30, 0, time.UTC) // Tuesday
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2030, 1, 1, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2030, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 9-17 * * *", time.Date(2030, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"30 8 * * *", time.Date(2030, 1, 2, 8, 30, 0, 0, time.UTC)},
+		{"0 0 * * sat,sun", time.Date(2030, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2030, 1, 6, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2032, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * fri", time.Date(2030, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2030, 1, 1, 10, 25, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2030, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		schedule, err := cron.Parse(tt.expr)
+		require.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.want, schedule.Next(start), tt.expr)
+	}
+}
+
+func TestSchedule_NextNeverMatches(t *testing.T) {
+	schedule, err := cron.Parse("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.True(t, schedule.Next(time.Now()).IsZero())
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"a * * * *",
+		"@often",
+	} {
+		_, err := cron.Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
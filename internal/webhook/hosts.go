@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrHostDenied means a callback URL points to an internal address which is not allowed explicitly
+var ErrHostDenied = errors.New("callback host is not allowed")
+
+// HostPolicy decides which hosts callback URLs of tasks may point to. Any client may set a callback URL,
+// so loopback, private, link-local and unspecified addresses are denied unless their host is listed
+// in the allowed hosts of the config
+type HostPolicy struct {
+	allowed map[string]struct{}
+}
+
+func NewHostPolicy(allowedHosts []string) HostPolicy {
+	allowed := make(map[string]struct{}, len(allowedHosts))
+	for _, host := range allowedHosts {
+		allowed[strings.ToLower(host)] = struct{}{}
+	}
+	return HostPolicy{allowed: allowed}
+}
+
+// CheckHost returns ErrHostDenied if host is localhost or an internal address literal and it is not allowed.
+// Other names are checked once they are resolved on delivery
+func (p HostPolicy) CheckHost(host string) error {
+	if p.isAllowed(host) {
+		return nil
+	}
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return fmt.Errorf("%w: %s", ErrHostDenied, host)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && internal(addr) {
+		return fmt.Errorf("%w: %s", ErrHostDenied, host)
+	}
+	return nil
+}
+
+func (p HostPolicy) isAllowed(host string) bool {
+	_, ok := p.allowed[strings.ToLower(host)]
+	return ok
+}
+
+// dialContext connects to allowed hosts as is and refuses to connect to internal addresses of the rest
+func (p HostPolicy) dialContext(timeout time.Duration) func(ctx context.Context, network, address string) (net.Conn, error) {
+	trusted := &net.Dialer{Timeout: timeout}
+	guarded := &net.Dialer{
+		Timeout: timeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if internal(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrHostDenied, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if p.isAllowed(host) {
+			return trusted.DialContext(ctx, network, address)
+		}
+		return guarded.DialContext(ctx, network, address)
+	}
+}
+
+// internal reports whether addr belongs to this host or a private network
+func internal(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsUnspecified()
+}
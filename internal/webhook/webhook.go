@@ -0,0 +1,231 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io-load-api/internal/config"
+	"io-load-api/internal/model"
+	"io-load-api/internal/utils/backoff"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// SignatureHeader carries "sha256=" followed by hex encoded HMAC-SHA256 of the timestamp, a dot and the body
+	SignatureHeader = "X-Webhook-Signature"
+	// TimestampHeader carries the Unix time the payload was signed at, so receivers can reject replays
+	TimestampHeader = "X-Webhook-Timestamp"
+)
+
+// DeliveryLog records webhook delivery attempts
+type DeliveryLog interface {
+	LogDelivery(ctx context.Context, delivery model.WebhookDelivery) error
+}
+
+// Payload is the body of a webhook
+type Payload struct {
+	ID             int64           `json:"id"`
+	Type           string          `json:"type"`
+	State          model.TaskState `json:"state"`
+	Attempts       int             `json:"attempts"`
+	ProcessEndedAt *time.Time      `json:"process_ended_at"`
+	Result         json.RawMessage `json:"result"`
+	Error          string          `json:"error,omitempty"`
+	ErrorCode      string          `json:"error_code,omitempty"`
+}
+
+// Notifier posts webhooks about completed and failed tasks in background and retries failed deliveries
+type Notifier struct {
+	log    *slog.Logger
+	client *http.Client
+	// callbackClient posts to callback URLs of tasks, which are set by clients and obey the host policy
+	callbackClient *http.Client
+	deliveries     DeliveryLog
+	url            string
+	secret         string
+	maxAttempts    int
+	baseDelay      time.Duration
+	multiplier     float64
+	jitter         float64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewNotifier(log *slog.Logger, deliveries DeliveryLog, cfg *config.Config) *Notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Notifier{
+		log:    log,
+		client: &http.Client{Timeout: cfg.Webhook.Timeout},
+		callbackClient: &http.Client{
+			Timeout: cfg.Webhook.Timeout,
+			Transport: &http.Transport{
+				DialContext: NewHostPolicy(cfg.Webhook.AllowedHosts).dialContext(cfg.Webhook.Timeout),
+			},
+		},
+		deliveries:  deliveries,
+		url:         cfg.Webhook.URL,
+		secret:      cfg.Webhook.Secret,
+		maxAttempts: cfg.Webhook.MaxAttempts,
+		baseDelay:   cfg.Webhook.BaseDelay,
+		multiplier:  cfg.Webhook.Multiplier,
+		jitter:      cfg.Webhook.Jitter,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Notify starts delivering a webhook about a completed or failed task to its callback URL or to the global one.
+// It does nothing for tasks in other states or if neither URL is set
+func (n *Notifier) Notify(task model.Task) {
+	if task.State != model.CompletedState && task.State != model.FailedState {
+		return
+	}
+	url, client := task.CallbackURL, n.callbackClient
+	if url == "" {
+		url, client = n.url, n.client
+	}
+	if url == "" {
+		return
+	}
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		n.deliver(client, url, task)
+	}()
+}
+
+// Stop waits for deliveries in progress. If ctx expires first, remaining retries are abandoned
+func (n *Notifier) Stop(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		n.cancel()
+		return nil
+	case <-ctx.Done():
+		n.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (n *Notifier) deliver(client *http.Client, url string, task model.Task) {
+	const op = "webhook.deliver"
+	log := n.log.With(slog.String("op", op), slog.Int64("task_id", task.ID), slog.String("url", url))
+
+	body, err := json.Marshal(Payload{
+		ID:             task.ID,
+		Type:           task.Type,
+		State:          task.State,
+		Attempts:       task.Attempts,
+		ProcessEndedAt: task.ProcessEndedAt,
+		Result:         task.Result,
+		Error:          task.Error,
+		ErrorCode:      task.ErrorCode,
+	})
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		statusCode, err := n.post(client, url, body)
+		delivery := model.WebhookDelivery{
+			TaskID:     task.ID,
+			URL:        url,
+			Attempt:    attempt,
+			StatusCode: statusCode,
+			Delivered:  err == nil,
+			CreatedAt:  time.Now(),
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		if logErr := n.deliveries.LogDelivery(context.Background(), delivery); logErr != nil {
+			log.Error(logErr.Error())
+		}
+
+		if err == nil {
+			log.Info("Delivered webhook", slog.Int("attempt", attempt))
+			return
+		}
+		if !retryable(statusCode) || errors.Is(err, ErrHostDenied) || attempt >= n.maxAttempts {
+			log.Warn("Failed to deliver webhook", slog.Int("attempts", attempt), slog.String("error", err.Error()))
+			return
+		}
+
+		delay := backoff.Exponential(n.baseDelay, n.multiplier, n.jitter, attempt)
+		select {
+		case <-n.ctx.Done():
+			log.Warn("Abandoned webhook delivery on shutdown", slog.Int("attempts", attempt))
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// post sends body to url and returns the response status code. Any status other than 2xx is an error
+func (n *Notifier) post(client *http.Client, url string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, Sign(n.secret, timestamp, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryable reports whether a delivery which got statusCode may succeed later.
+// Zero status code means there was no response at all
+func retryable(statusCode int) bool {
+	return statusCode == 0 ||
+		statusCode == http.StatusRequestTimeout ||
+		statusCode == http.StatusTooManyRequests ||
+		statusCode >= http.StatusInternalServerError
+}
+
+// Sign returns the value of SignatureHeader for body signed at timestamp
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is a valid signature of body signed at timestamp
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
@@ -0,0 +1,197 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io-load-api/internal/config"
+	"io-load-api/internal/model"
+	"io-load-api/internal/webhook"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// deliveryLog keeps delivery records in memory
+type deliveryLog struct {
+	mu         sync.Mutex
+	deliveries []model.WebhookDelivery
+}
+
+func (l *deliveryLog) LogDelivery(_ context.Context, delivery model.WebhookDelivery) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.deliveries = append(l.deliveries, delivery)
+	return nil
+}
+
+func newNotifier(deliveries webhook.DeliveryLog, url string, allowedHosts ...string) *webhook.Notifier {
+	cfg := &config.Config{Webhook: config.Webhook{
+		URL:          url,
+		AllowedHosts: allowedHosts,
+		Secret:       "secret",
+		Timeout:      time.Second,
+		MaxAttempts:  3,
+		BaseDelay:    time.Millisecond,
+		Multiplier:   2,
+	}}
+	return webhook.NewNotifier(slog.Default(), deliveries, cfg)
+}
+
+func TestNotifier_DeliversSignedPayload(t *testing.T) {
+	received := make(chan webhook.Payload, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get(webhook.TimestampHeader)
+		if !webhook.Verify("secret", timestamp, body, r.Header.Get(webhook.SignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload webhook.Payload
+		_ = json.Unmarshal(body, &payload)
+		received <- payload
+	}))
+	defer receiver.Close()
+
+	deliveries := &deliveryLog{}
+	// The test receiver listens on the loopback address
+	notifier := newNotifier(deliveries, "", "127.0.0.1")
+	notifier.Notify(model.Task{
+		ID:          1,
+		Type:        "fetch_url",
+		State:       model.CompletedState,
+		Result:      json.RawMessage(`{"status":200}`),
+		CallbackURL: receiver.URL,
+	})
+	assert.NoError(t, notifier.Stop(context.Background()))
+
+	payload := <-received
+	assert.Equal(t, int64(1), payload.ID)
+	assert.Equal(t, model.CompletedState, payload.State)
+	assert.JSONEq(t, `{"status":200}`, string(payload.Result))
+	assert.Len(t, deliveries.deliveries, 1)
+	assert.True(t, deliveries.deliveries[0].Delivered)
+	assert.Equal(t, http.StatusOK, deliveries.deliveries[0].StatusCode)
+}
+
+func TestNotifier_RetriesFailedDelivery(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	deliveries := &deliveryLog{}
+	notifier := newNotifier(deliveries, receiver.URL)
+	notifier.Notify(model.Task{ID: 1, State: model.FailedState})
+	assert.NoError(t, notifier.Stop(context.Background()))
+
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Len(t, deliveries.deliveries, 3)
+	assert.Equal(t, http.StatusServiceUnavailable, deliveries.deliveries[0].StatusCode)
+	assert.False(t, deliveries.deliveries[1].Delivered)
+	assert.True(t, deliveries.deliveries[2].Delivered)
+}
+
+func TestNotifier_DoesNotRetryRejectedDelivery(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer receiver.Close()
+
+	deliveries := &deliveryLog{}
+	notifier := newNotifier(deliveries, receiver.URL)
+	notifier.Notify(model.Task{ID: 1, State: model.FailedState})
+	assert.NoError(t, notifier.Stop(context.Background()))
+
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Len(t, deliveries.deliveries, 1)
+	assert.NotEmpty(t, deliveries.deliveries[0].Error)
+}
+
+func TestNotifier_SkipsTasksWithoutURL(t *testing.T) {
+	deliveries := &deliveryLog{}
+	notifier := newNotifier(deliveries, "")
+	notifier.Notify(model.Task{ID: 1, State: model.CompletedState})
+	assert.NoError(t, notifier.Stop(context.Background()))
+
+	assert.Empty(t, deliveries.deliveries)
+}
+
+func TestNotifier_SkipsUnfinishedAndCancelledTasks(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer receiver.Close()
+
+	deliveries := &deliveryLog{}
+	notifier := newNotifier(deliveries, receiver.URL)
+	for _, state := range []model.TaskState{model.RetryingState, model.CancelledState, model.TimedOutState} {
+		notifier.Notify(model.Task{ID: 1, State: state})
+	}
+	assert.NoError(t, notifier.Stop(context.Background()))
+
+	assert.Zero(t, calls.Load())
+	assert.Empty(t, deliveries.deliveries)
+}
+
+func TestNotifier_DeniesInternalCallbackHosts(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer receiver.Close()
+
+	deliveries := &deliveryLog{}
+	notifier := newNotifier(deliveries, "")
+	notifier.Notify(model.Task{ID: 1, State: model.CompletedState, CallbackURL: receiver.URL})
+	assert.NoError(t, notifier.Stop(context.Background()))
+
+	assert.Zero(t, calls.Load())
+	// Denied deliveries are not retried
+	assert.Len(t, deliveries.deliveries, 1)
+	assert.Contains(t, deliveries.deliveries[0].Error, webhook.ErrHostDenied.Error())
+}
+
+func TestHostPolicy_CheckHost(t *testing.T) {
+	policy := webhook.NewHostPolicy([]string{"receiver.internal", "10.0.0.5"})
+
+	tests := []struct {
+		host    string
+		allowed bool
+	}{
+		{"example.com", true},
+		{"93.184.216.34", true},
+		{"receiver.internal", true},
+		{"10.0.0.5", true},
+		{"localhost", false},
+		{"api.localhost", false},
+		{"127.0.0.1", false},
+		{"169.254.169.254", false},
+		{"10.0.0.6", false},
+		{"::1", false},
+		{"::ffff:192.168.0.1", false},
+		{"0.0.0.0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			err := policy.CheckHost(tt.host)
+
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, webhook.ErrHostDenied)
+			}
+		})
+	}
+}
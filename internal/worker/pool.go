@@ -0,0 +1,139 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io-load-api/internal/config"
+	"io-load-api/internal/model"
+	"io-load-api/internal/store"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrShutdown is the cause of cancellation of tasks still running when the pool stop deadline expires
+var ErrShutdown = errors.New("worker pool is shutting down")
+
+// ClaimFunc takes the next pending task from the queue.
+// It returns store.ErrNoPendingTasks when there is nothing to process
+type ClaimFunc func(ctx context.Context) (model.Task, error)
+
+// Handler processes a single claimed task
+type Handler func(ctx context.Context, task model.Task)
+
+// interruptTimeout bounds how long Stop waits for handlers of cancelled tasks to return. A handler which ignores
+// its context is abandoned then, and the lease of its task expires, so the task is recovered by the reaper
+const interruptTimeout = time.Second
+
+// Pool runs a fixed number of workers which claim pending tasks from the store.
+// Idle workers wake up on Notify or every poll interval, so tasks created by other instances are picked up too
+type Pool struct {
+	log          *slog.Logger
+	size         int
+	pollInterval time.Duration
+	wake         chan struct{}
+
+	quit     chan struct{}
+	stopOnce sync.Once
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
+}
+
+func NewPool(log *slog.Logger, cfg *config.Config) *Pool {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &Pool{
+		log:          log,
+		size:         cfg.WorkerPool.Size,
+		pollInterval: cfg.WorkerPool.PollInterval,
+		wake:         make(chan struct{}, cfg.WorkerPool.Size),
+		quit:         make(chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// Start launches workers which claim tasks with claim and pass them to handler
+func (p *Pool) Start(claim ClaimFunc, handler Handler) {
+	p.log.Info("Starting worker pool", slog.Int("workers", p.size), slog.Duration("poll_interval", p.pollInterval))
+	for i := 0; i < p.size; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.work(claim, handler)
+		}()
+	}
+}
+
+func (p *Pool) work(claim ClaimFunc, handler Handler) {
+	const op = "worker.work"
+	log := p.log.With(slog.String("op", op))
+
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.quit:
+			return
+		default:
+		}
+
+		task, err := claim(p.ctx)
+		if err == nil {
+			handler(p.ctx, task)
+			continue
+		}
+		if !errors.Is(err, store.ErrNoPendingTasks) && p.ctx.Err() == nil {
+			log.Error(err.Error())
+		}
+
+		select {
+		case <-p.quit:
+			return
+		case <-p.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Notify wakes up an idle worker to claim a newly created task
+func (p *Pool) Notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stop prevents workers from claiming new tasks and waits until running ones finish.
+// If ctx expires first, running tasks are cancelled with ErrShutdown cause and Stop waits a short while
+// for their handlers to return
+func (p *Pool) Stop(ctx context.Context) error {
+	const op = "worker.Stop"
+	log := p.log.With(slog.String("op", op))
+
+	p.stopOnce.Do(func() {
+		close(p.quit)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel(ErrShutdown)
+		return nil
+	case <-ctx.Done():
+		p.cancel(ErrShutdown)
+		select {
+		case <-done:
+		case <-time.After(interruptTimeout):
+			log.Warn("Abandoned task handlers which did not return after cancellation")
+		}
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,140 @@
+package worker_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io-load-api/internal/config"
+	"io-load-api/internal/model"
+	"io-load-api/internal/store"
+	"io-load-api/internal/worker"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// queue is a claim source backed by a slice
+type queue struct {
+	mu    sync.Mutex
+	tasks []model.Task
+}
+
+func (q *queue) push(task model.Task) {
+	q.mu.Lock()
+	q.tasks = append(q.tasks, task)
+	q.mu.Unlock()
+}
+
+func (q *queue) claim(context.Context) (model.Task, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.tasks) == 0 {
+		return model.Task{}, store.ErrNoPendingTasks
+	}
+	task := q.tasks[0]
+	q.tasks = q.tasks[1:]
+	return task, nil
+}
+
+func newPool(size int, pollInterval time.Duration) *worker.Pool {
+	cfg := &config.Config{WorkerPool: config.WorkerPool{Size: size, PollInterval: pollInterval}}
+	return worker.NewPool(slog.Default(), cfg)
+}
+
+func TestPool_ProcessesClaimedTasks(t *testing.T) {
+	pool := newPool(2, time.Hour)
+	q := &queue{}
+	for i := int64(1); i <= 5; i++ {
+		q.push(model.Task{ID: i})
+	}
+
+	var (
+		mu        sync.Mutex
+		processed []int64
+	)
+	done := make(chan struct{})
+	pool.Start(q.claim, func(ctx context.Context, task model.Task) {
+		mu.Lock()
+		defer mu.Unlock()
+		processed = append(processed, task.ID)
+		if len(processed) == 5 {
+			close(done)
+		}
+	})
+
+	<-done
+	assert.NoError(t, pool.Stop(context.Background()))
+	assert.ElementsMatch(t, []int64{1, 2, 3, 4, 5}, processed)
+}
+
+func TestPool_NotifyWakesIdleWorker(t *testing.T) {
+	pool := newPool(1, time.Hour)
+	q := &queue{}
+
+	processed := make(chan int64, 1)
+	pool.Start(q.claim, func(ctx context.Context, task model.Task) {
+		processed <- task.ID
+	})
+
+	// Give the worker time to find the queue empty and go idle
+	time.Sleep(20 * time.Millisecond)
+	q.push(model.Task{ID: 7})
+	pool.Notify()
+
+	select {
+	case id := <-processed:
+		assert.Equal(t, int64(7), id)
+	case <-time.After(time.Second):
+		t.Fatal("worker was not woken up")
+	}
+	assert.NoError(t, pool.Stop(context.Background()))
+}
+
+func TestPool_StopCancelsRunningTasks(t *testing.T) {
+	pool := newPool(1, time.Hour)
+	q := &queue{}
+	q.push(model.Task{ID: 1})
+
+	started := make(chan struct{})
+	var cause error
+	pool.Start(q.claim, func(ctx context.Context, task model.Task) {
+		close(started)
+		<-ctx.Done()
+		cause = context.Cause(ctx)
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, pool.Stop(ctx), context.DeadlineExceeded)
+	assert.ErrorIs(t, cause, worker.ErrShutdown)
+}
+
+func TestPool_StopAbandonsHandlersIgnoringCancellation(t *testing.T) {
+	pool := newPool(1, time.Hour)
+	q := &queue{}
+	q.push(model.Task{ID: 1})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	pool.Start(q.claim, func(ctx context.Context, task model.Task) {
+		close(started)
+		<-release
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stopped := make(chan error)
+	go func() {
+		stopped <- pool.Stop(ctx)
+	}()
+
+	select {
+	case err := <-stopped:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop waited for a handler which ignores cancellation")
+	}
+}
@@ -0,0 +1,4 @@
+ALTER TABLE tasks
+    DROP COLUMN IF EXISTS callback_url;
+
+DROP TABLE IF EXISTS webhook_deliveries;
\ No newline at end of file
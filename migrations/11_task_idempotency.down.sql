@@ -0,0 +1,3 @@
+ALTER TABLE tasks
+    DROP COLUMN IF EXISTS idempotency_key,
+    DROP COLUMN IF EXISTS request_hash;
\ No newline at end of file
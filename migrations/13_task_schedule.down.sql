@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS tasks_scheduled_idx;
+ALTER TABLE tasks
+    DROP COLUMN IF EXISTS run_at;
\ No newline at end of file
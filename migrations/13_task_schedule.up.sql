@@ -0,0 +1,4 @@
+ALTER TABLE tasks
+    ADD COLUMN IF NOT EXISTS run_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS tasks_scheduled_idx ON tasks (run_at) WHERE state = 'SCHEDULED';
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS schedules (
+    id BIGSERIAL PRIMARY KEY,
+    cron_expr TEXT NOT NULL,
+    template JSONB NOT NULL,
+    next_run_at TIMESTAMP NOT NULL,
+    last_run_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS schedules_next_run_at_idx ON schedules (next_run_at);
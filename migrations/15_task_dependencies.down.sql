@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS tasks_waiting_idx;
+DROP TABLE IF EXISTS task_dependencies;
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS task_dependencies (
+    task_id INTEGER NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+    depends_on_id INTEGER NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+    PRIMARY KEY (task_id, depends_on_id)
+);
+
+CREATE INDEX IF NOT EXISTS task_dependencies_depends_on_idx ON task_dependencies (depends_on_id);
+CREATE INDEX IF NOT EXISTS tasks_waiting_idx ON tasks (id) WHERE state = 'WAITING';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS tasks_awaiting_children_idx;
+DROP INDEX IF EXISTS tasks_parent_idx;
+ALTER TABLE tasks
+    DROP COLUMN IF EXISTS parent_id;
\ No newline at end of file
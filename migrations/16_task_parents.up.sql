@@ -0,0 +1,5 @@
+ALTER TABLE tasks
+    ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES tasks (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS tasks_parent_idx ON tasks (parent_id, id) WHERE parent_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS tasks_awaiting_children_idx ON tasks (id) WHERE state = 'AWAITING_CHILDREN';
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS tasks_claim_idx;
\ No newline at end of file
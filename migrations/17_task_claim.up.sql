@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS tasks_claim_idx ON tasks (priority DESC, id) WHERE state IN ('PENDING', 'RETRYING');
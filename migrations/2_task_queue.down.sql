@@ -0,0 +1 @@
+DROP INDEX IF EXISTS tasks_pending_idx;
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS tasks_pending_idx ON tasks (id) WHERE state = 'PENDING';
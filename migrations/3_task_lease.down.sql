@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS tasks_processing_lease_idx;
+
+ALTER TABLE tasks DROP COLUMN IF EXISTS lease_expires_at;
\ No newline at end of file
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS tasks_queue_idx;
+CREATE INDEX IF NOT EXISTS tasks_pending_idx ON tasks (id) WHERE state = 'PENDING';
+
+ALTER TABLE tasks
+    DROP COLUMN IF EXISTS attempts,
+    DROP COLUMN IF EXISTS max_attempts,
+    DROP COLUMN IF EXISTS retry_base_delay_ms,
+    DROP COLUMN IF EXISTS retry_multiplier,
+    DROP COLUMN IF EXISTS retry_jitter,
+    DROP COLUMN IF EXISTS next_run_at;
\ No newline at end of file
@@ -0,0 +1,10 @@
+ALTER TABLE tasks
+    ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS max_attempts INT NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS retry_base_delay_ms BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS retry_multiplier DOUBLE PRECISION NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS retry_jitter DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS next_run_at TIMESTAMP;
+
+DROP INDEX IF EXISTS tasks_pending_idx;
+CREATE INDEX IF NOT EXISTS tasks_queue_idx ON tasks (id) WHERE state IN ('PENDING', 'RETRYING');
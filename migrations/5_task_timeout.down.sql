@@ -0,0 +1,3 @@
+ALTER TABLE tasks
+    DROP COLUMN IF EXISTS timeout_ms,
+    DROP COLUMN IF EXISTS deadline;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE tasks
+    ADD COLUMN IF NOT EXISTS timeout_ms BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS deadline TIMESTAMP;
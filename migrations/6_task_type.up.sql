@@ -0,0 +1 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS type TEXT NOT NULL DEFAULT 'simulate_io';
@@ -0,0 +1,3 @@
+ALTER TABLE tasks
+    DROP COLUMN IF EXISTS payload,
+    DROP COLUMN IF EXISTS result;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE tasks
+    ADD COLUMN IF NOT EXISTS payload JSONB,
+    ADD COLUMN IF NOT EXISTS result JSONB;
@@ -0,0 +1,3 @@
+ALTER TABLE tasks
+    DROP COLUMN IF EXISTS error_message,
+    DROP COLUMN IF EXISTS error_code;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE tasks
+    ADD COLUMN IF NOT EXISTS error_message TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS error_code TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS tasks_created_at_idx;
+DROP INDEX IF EXISTS tasks_state_idx;
\ No newline at end of file
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS tasks_created_at_idx ON tasks (created_at, id);
+CREATE INDEX IF NOT EXISTS tasks_state_idx ON tasks (state, id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS schedules;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS task_dependencies;
+DROP TABLE IF EXISTS tasks;
\ No newline at end of file
@@ -0,0 +1,69 @@
+-- Timestamps are Unix times in microseconds, JSON documents are stored as text
+CREATE TABLE IF NOT EXISTS tasks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type TEXT NOT NULL DEFAULT 'simulate_io',
+    state TEXT NOT NULL DEFAULT 'PENDING',
+    created_at INTEGER NOT NULL,
+    process_started_at INTEGER,
+    process_ended_at INTEGER,
+    lease_expires_at INTEGER,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 1,
+    retry_base_delay_ms INTEGER NOT NULL DEFAULT 0,
+    retry_multiplier REAL NOT NULL DEFAULT 1,
+    retry_jitter REAL NOT NULL DEFAULT 0,
+    next_run_at INTEGER,
+    timeout_ms INTEGER NOT NULL DEFAULT 0,
+    deadline INTEGER,
+    payload TEXT,
+    result TEXT,
+    error_message TEXT NOT NULL DEFAULT '',
+    error_code TEXT NOT NULL DEFAULT '',
+    callback_url TEXT NOT NULL DEFAULT '',
+    idempotency_key TEXT UNIQUE,
+    request_hash TEXT NOT NULL DEFAULT '',
+    priority INTEGER NOT NULL DEFAULT 0,
+    run_at INTEGER,
+    parent_id INTEGER REFERENCES tasks (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS tasks_queue_idx ON tasks (id) WHERE state IN ('PENDING', 'RETRYING');
+CREATE INDEX IF NOT EXISTS tasks_processing_lease_idx ON tasks (lease_expires_at) WHERE state = 'PROCESSING';
+CREATE INDEX IF NOT EXISTS tasks_created_at_idx ON tasks (created_at, id);
+CREATE INDEX IF NOT EXISTS tasks_state_idx ON tasks (state, id);
+CREATE INDEX IF NOT EXISTS tasks_scheduled_idx ON tasks (run_at) WHERE state = 'SCHEDULED';
+CREATE INDEX IF NOT EXISTS tasks_waiting_idx ON tasks (id) WHERE state = 'WAITING';
+CREATE INDEX IF NOT EXISTS tasks_parent_idx ON tasks (parent_id, id) WHERE parent_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS tasks_awaiting_children_idx ON tasks (id) WHERE state = 'AWAITING_CHILDREN';
+
+CREATE TABLE IF NOT EXISTS task_dependencies (
+    task_id INTEGER NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+    depends_on_id INTEGER NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+    PRIMARY KEY (task_id, depends_on_id)
+);
+
+CREATE INDEX IF NOT EXISTS task_dependencies_depends_on_idx ON task_dependencies (depends_on_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task_id INTEGER NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    attempt INTEGER NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    error_message TEXT NOT NULL DEFAULT '',
+    delivered INTEGER NOT NULL DEFAULT 0,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_task_idx ON webhook_deliveries (task_id);
+
+CREATE TABLE IF NOT EXISTS schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    cron_expr TEXT NOT NULL,
+    template TEXT NOT NULL,
+    next_run_at INTEGER NOT NULL,
+    last_run_at INTEGER,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS schedules_next_run_at_idx ON schedules (next_run_at);